@@ -0,0 +1,99 @@
+// Package diagnostic describes problems found in source code and renders them
+// with excerpts of the source that they are about.
+package diagnostic
+
+import "fmt"
+
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Span is the source from Start up to, but not including, End. A span with a
+// zero Start is unknown.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// Label describes a span of source.
+type Label struct {
+	Span    Span
+	Message string
+}
+
+// Severity is how serious a diagnostic is. The zero value is SeverityError.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityNote
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityNote:
+		return "note"
+	}
+	return "error"
+}
+
+// Edit replaces the source in Span with Text. An empty span inserts the text.
+type Edit struct {
+	Span Span
+	Text string
+}
+
+// Fix is a suggested change to the source that resolves a diagnostic.
+type Fix struct {
+	Message string
+	Edits   []Edit
+}
+
+// Diagnostic is a problem with source code.
+type Diagnostic struct {
+	Severity Severity
+	// Code identifies the kind of problem, such as "E202" for a missing
+	// token. Codes don't change between versions, so tools can rely on them.
+	Code    string
+	Message string
+	// Span is the source with the problem, which Label describes in a few
+	// words.
+	Span  Span
+	Label string
+	// Related are other spans that help explain the problem, such as the
+	// unclosed "{" for a missing "}".
+	Related []Label
+	Fixes   []Fix
+}
+
+// Error returns the message of the diagnostic, so that errors.As can find it
+// in the errors of the tokenize and parser packages.
+func (d Diagnostic) Error() string {
+	return d.Message
+}
+
+// Error is an error that can describe itself as a Diagnostic.
+type Error interface {
+	error
+	Diagnostic() Diagnostic
+}
+
+// As sets target to the diagnostic for err if it is a **Diagnostic. Errors
+// implement their As method with it, so that errors.As can find their
+// diagnostics.
+func As(err Error, target interface{}) bool {
+	d, ok := target.(**Diagnostic)
+	if ok {
+		diagnostic := err.Diagnostic()
+		*d = &diagnostic
+	}
+	return ok
+}
@@ -0,0 +1,258 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const source = "let a = 1\nwhile (a) {\n\tf(a b)\n\tg()\n\n\th(\n\t\ta)\n"
+
+func span(line, column, endLine, endColumn int) Span {
+	return Span{Start: Position{Line: line, Column: column}, End: Position{Line: endLine, Column: endColumn}}
+}
+
+func TestRender(t *testing.T) {
+	cases := []struct {
+		diagnostic Diagnostic
+		expected   string
+	}{
+		{
+			Diagnostic{Message: "Input is too large"},
+			"error: Input is too large\n",
+		},
+		{
+			Diagnostic{Message: "Unexpected b", Span: span(3, 6, 3, 7), Label: "unexpected token"},
+			"error: Unexpected b\n" +
+				" --> test:3:6\n" +
+				"  |\n" +
+				"3 | \tf(a b)\n" +
+				"  | \t    ^ unexpected token\n",
+		},
+		{
+			Diagnostic{
+				Message: "Missing )",
+				Span:    span(3, 5, 3, 5),
+				Label:   "expected \")\"",
+				Related: []Label{{Span: span(3, 3, 3, 4), Message: "unclosed \"(\" opened here"}},
+			},
+			"error: Missing )\n" +
+				" --> test:3:5\n" +
+				"  |\n" +
+				"3 | \tf(a b)\n" +
+				"  | \t - unclosed \"(\" opened here\n" +
+				"  | \t   ^ expected \")\"\n",
+		},
+		{
+			Diagnostic{
+				Message: "Missing }",
+				Span:    span(4, 5, 4, 5),
+				Related: []Label{{Span: span(2, 11, 2, 12), Message: "opened here"}},
+			},
+			"error: Missing }\n" +
+				" --> test:4:5\n" +
+				"  |\n" +
+				"2 | while (a) {\n" +
+				"  |           - opened here\n" +
+				"3 | \tf(a b)\n" +
+				"4 | \tg()\n" +
+				"  | \t   ^\n",
+		},
+		{
+			Diagnostic{
+				Message: "Redeclared",
+				Span:    span(6, 2, 7, 5),
+				Label:   "call",
+				Related: []Label{{Span: span(1, 5, 1, 6), Message: "declared here"}},
+			},
+			"error: Redeclared\n" +
+				" --> test:6:2\n" +
+				"  |\n" +
+				"1 | let a = 1\n" +
+				"  |     - declared here\n" +
+				"...\n" +
+				"6 | \th(\n" +
+				"  | \t^^ call\n",
+		},
+		{
+			Diagnostic{Message: "Unexpected end", Span: span(8, 1, 8, 1), Label: "here"},
+			"error: Unexpected end\n" +
+				" --> test:8:1\n" +
+				"  |\n" +
+				"8 |\n" +
+				"  | ^ here\n",
+		},
+	}
+	for _, test := range cases {
+		var sb strings.Builder
+		assert.NoError(t, Renderer{}.Render(&sb, "test", []byte(source), test.diagnostic))
+		assert.Equal(t, test.expected, sb.String(), "Wrong output for %s", test.diagnostic.Message)
+	}
+}
+
+func TestRenderColor(t *testing.T) {
+	var sb strings.Builder
+	d := Diagnostic{
+		Message: "Missing )",
+		Span:    span(3, 5, 3, 5),
+		Related: []Label{{Span: span(3, 3, 3, 4), Message: "opened here"}},
+	}
+	assert.NoError(t, Renderer{Color: true}.Render(&sb, "test", []byte(source), d))
+	output := sb.String()
+	assert.True(t, strings.HasPrefix(output, red+"error"+reset+bold+": Missing )"+reset+"\n"))
+	assert.Contains(t, output, blue+"3 | "+reset+"\tf(a b)\n")
+	assert.Contains(t, output, "\t   "+red+"^"+reset+"\n")
+	assert.Contains(t, output, "\t "+blue+"- opened here"+reset+"\n")
+}
+
+func TestRenderCodeAndFixes(t *testing.T) {
+	var sb strings.Builder
+	d := Diagnostic{
+		Severity: SeverityWarning,
+		Code:     "E999",
+		Message:  "Unused",
+		Span:     span(1, 5, 1, 6),
+		Fixes:    []Fix{{Message: "Remove it"}, {Message: "Use it"}},
+	}
+	assert.NoError(t, Renderer{}.Render(&sb, "test", []byte(source), d))
+	assert.Equal(t, "warning[E999]: Unused\n"+
+		" --> test:1:5\n"+
+		"  |\n"+
+		"1 | let a = 1\n"+
+		"  |     ^\n"+
+		"  = help: Remove it\n"+
+		"  = help: Use it\n", sb.String())
+
+	sb.Reset()
+	d = Diagnostic{Severity: SeverityNote, Message: "Nothing to see", Fixes: []Fix{{Message: "Look elsewhere"}}}
+	assert.NoError(t, Renderer{}.Render(&sb, "test", []byte(source), d))
+	assert.Equal(t, "note: Nothing to see\n = help: Look elsewhere\n", sb.String())
+}
+
+type testError struct {
+	code string
+}
+
+func (e *testError) Error() string {
+	return "test error " + e.code
+}
+
+func (e *testError) Diagnostic() Diagnostic {
+	return Diagnostic{Code: e.code, Message: e.Error()}
+}
+
+func (e *testError) As(target interface{}) bool {
+	return As(e, target)
+}
+
+func TestAs(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", &testError{code: "E1"})
+	var d *Diagnostic
+	if assert.True(t, errors.As(err, &d)) {
+		assert.Equal(t, Diagnostic{Code: "E1", Message: "test error E1"}, *d)
+		assert.Equal(t, "test error E1", d.Error())
+	}
+	var other *testError
+	assert.True(t, errors.As(err, &other))
+	assert.False(t, errors.As(errors.New("plain"), &d))
+}
+
+var files = []File{
+	{Name: "clean.lang"},
+	{Name: "main.lang", Diagnostics: []Diagnostic{
+		{
+			Code:    "E202",
+			Message: "Missing )",
+			Span:    span(3, 5, 3, 5),
+			Label:   "expected \")\"",
+			Related: []Label{{Span: span(3, 3, 3, 4), Message: "opened here"}},
+			Fixes:   []Fix{{Message: "Insert \")\"", Edits: []Edit{{Span: span(3, 5, 3, 5), Text: ")"}}}},
+		},
+		{Severity: SeverityWarning, Message: "Too large"},
+		{Code: "E202", Message: "Missing }", Span: span(4, 1, 4, 1)},
+	}},
+}
+
+func TestWriteJSON(t *testing.T) {
+	var sb strings.Builder
+	assert.NoError(t, WriteJSON(&sb, files))
+	var result []map[string]interface{}
+	if !assert.NoError(t, json.Unmarshal([]byte(sb.String()), &result)) || !assert.Len(t, result, 3) {
+		return
+	}
+	position := func(line, column float64) map[string]interface{} {
+		return map[string]interface{}{"line": line, "column": column}
+	}
+	insertion := map[string]interface{}{"start": position(3, 5), "end": position(3, 5)}
+	assert.Equal(t, map[string]interface{}{
+		"file":     "main.lang",
+		"severity": "error",
+		"code":     "E202",
+		"message":  "Missing )",
+		"span":     insertion,
+		"label":    "expected \")\"",
+		"related": []interface{}{map[string]interface{}{
+			"span":    map[string]interface{}{"start": position(3, 3), "end": position(3, 4)},
+			"message": "opened here",
+		}},
+		"fixes": []interface{}{map[string]interface{}{
+			"message": "Insert \")\"",
+			"edits":   []interface{}{map[string]interface{}{"span": insertion, "text": ")"}},
+		}},
+	}, result[0])
+	assert.Equal(t, map[string]interface{}{
+		"file":     "main.lang",
+		"severity": "warning",
+		"message":  "Too large",
+		"related":  []interface{}{},
+		"fixes":    []interface{}{},
+	}, result[1])
+
+	sb.Reset()
+	assert.NoError(t, WriteJSON(&sb, nil))
+	assert.Equal(t, "[]\n", sb.String())
+}
+
+func TestWriteSARIF(t *testing.T) {
+	var sb strings.Builder
+	assert.NoError(t, WriteSARIF(&sb, "interpreter", files))
+	var log sarifLog
+	if !assert.NoError(t, json.Unmarshal([]byte(sb.String()), &log)) || !assert.Len(t, log.Runs, 1) {
+		return
+	}
+	assert.Equal(t, "2.1.0", log.Version)
+	run := log.Runs[0]
+	assert.Equal(t, "interpreter", run.Tool.Driver.Name)
+	assert.Equal(t, []sarifRule{{ID: "E202"}}, run.Tool.Driver.Rules)
+	if !assert.Len(t, run.Results, 3) {
+		return
+	}
+
+	result := run.Results[0]
+	assert.Equal(t, "E202", result.RuleID)
+	assert.Equal(t, "error", result.Level)
+	assert.Equal(t, "Missing )", result.Message.Text)
+	location := result.Locations[0].PhysicalLocation
+	assert.Equal(t, "main.lang", location.ArtifactLocation.URI)
+	assert.Equal(t, &sarifRegion{StartLine: 3, StartColumn: 5, EndLine: 3, EndColumn: 5}, location.Region)
+	assert.Equal(t, "opened here", result.RelatedLocations[0].Message.Text)
+	assert.Equal(t, &sarifRegion{StartLine: 3, StartColumn: 3, EndLine: 3, EndColumn: 4}, result.RelatedLocations[0].PhysicalLocation.Region)
+	assert.Equal(t, []sarifFix{{
+		Description: sarifMessage{Text: "Insert \")\""},
+		ArtifactChanges: []sarifArtifactChange{{
+			ArtifactLocation: sarifArtifactLocation{URI: "main.lang"},
+			Replacements: []sarifReplacement{{
+				DeletedRegion:   sarifRegion{StartLine: 3, StartColumn: 5, EndLine: 3, EndColumn: 5},
+				InsertedContent: sarifMessage{Text: ")"},
+			}},
+		}},
+	}}, result.Fixes)
+
+	assert.Equal(t, "warning", run.Results[1].Level)
+	assert.Empty(t, run.Results[1].RuleID)
+	assert.Nil(t, run.Results[1].Locations[0].PhysicalLocation.Region)
+}
@@ -0,0 +1,98 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// File holds the diagnostics for the file with the given name.
+type File struct {
+	Name        string
+	Diagnostics []Diagnostic
+}
+
+type jsonPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type jsonSpan struct {
+	Start jsonPosition `json:"start"`
+	End   jsonPosition `json:"end"`
+}
+
+type jsonLabel struct {
+	Span    *jsonSpan `json:"span,omitempty"`
+	Message string    `json:"message"`
+}
+
+type jsonEdit struct {
+	Span jsonSpan `json:"span"`
+	Text string   `json:"text"`
+}
+
+type jsonFix struct {
+	Message string     `json:"message"`
+	Edits   []jsonEdit `json:"edits"`
+}
+
+type jsonDiagnostic struct {
+	File     string      `json:"file"`
+	Severity string      `json:"severity"`
+	Code     string      `json:"code,omitempty"`
+	Message  string      `json:"message"`
+	Span     *jsonSpan   `json:"span,omitempty"`
+	Label    string      `json:"label,omitempty"`
+	Related  []jsonLabel `json:"related"`
+	Fixes    []jsonFix   `json:"fixes"`
+}
+
+func newJSONSpan(span Span) jsonSpan {
+	return jsonSpan{
+		Start: jsonPosition{Line: span.Start.Line, Column: span.Start.Column},
+		End:   jsonPosition{Line: span.End.Line, Column: span.End.Column},
+	}
+}
+
+// optionalJSONSpan returns nil for an unknown span, which is left out.
+func optionalJSONSpan(span Span) *jsonSpan {
+	if span.Start.Line == 0 {
+		return nil
+	}
+	result := newJSONSpan(span)
+	return &result
+}
+
+// WriteJSON writes the diagnostics of the files as a JSON array with an
+// object for each diagnostic, which names its file. Lines and columns start
+// at 1, and spans end after their last character.
+func WriteJSON(w io.Writer, files []File) error {
+	diagnostics := make([]jsonDiagnostic, 0)
+	for _, file := range files {
+		for _, d := range file.Diagnostics {
+			result := jsonDiagnostic{
+				File:     file.Name,
+				Severity: d.Severity.String(),
+				Code:     d.Code,
+				Message:  d.Message,
+				Span:     optionalJSONSpan(d.Span),
+				Label:    d.Label,
+				Related:  make([]jsonLabel, len(d.Related)),
+				Fixes:    make([]jsonFix, len(d.Fixes)),
+			}
+			for i, related := range d.Related {
+				result.Related[i] = jsonLabel{Span: optionalJSONSpan(related.Span), Message: related.Message}
+			}
+			for i, fix := range d.Fixes {
+				result.Fixes[i] = jsonFix{Message: fix.Message, Edits: make([]jsonEdit, len(fix.Edits))}
+				for j, edit := range fix.Edits {
+					result.Fixes[i].Edits[j] = jsonEdit{Span: newJSONSpan(edit.Span), Text: edit.Text}
+				}
+			}
+			diagnostics = append(diagnostics, result)
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(diagnostics)
+}
@@ -0,0 +1,156 @@
+package diagnostic
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	reset  = "\x1b[0m"
+	bold   = "\x1b[1m"
+	red    = "\x1b[1;31m"
+	blue   = "\x1b[1;34m"
+	yellow = "\x1b[1;33m"
+)
+
+// Renderer writes diagnostics with the lines of source that they are about,
+// underlining the span of the problem with carets and related spans with
+// dashes.
+type Renderer struct {
+	// Color highlights the output with ANSI escape codes.
+	Color bool
+}
+
+// IsTerminal reports whether f is a terminal, which diagnostics written to it
+// can be colored for.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+type marker struct {
+	Label
+	primary bool
+}
+
+// Render writes d for the source of the file with the given name.
+func (r Renderer) Render(w io.Writer, name string, source []byte, d Diagnostic) error {
+	var sb strings.Builder
+	severity := red
+	if d.Severity != SeverityError {
+		severity = yellow
+	}
+	title := d.Severity.String()
+	if d.Code != "" {
+		title += "[" + d.Code + "]"
+	}
+	sb.WriteString(r.style(severity, title) + r.style(bold, ": "+d.Message) + "\n")
+	if d.Span.Start.Line == 0 {
+		r.writeFixes(&sb, "", d.Fixes)
+		_, err := io.WriteString(w, sb.String())
+		return err
+	}
+
+	markers := []marker{{Label: Label{Span: d.Span, Message: d.Label}, primary: true}}
+	for _, related := range d.Related {
+		if related.Span.Start.Line > 0 {
+			markers = append(markers, marker{Label: related})
+		}
+	}
+	sort.SliceStable(markers, func(i, j int) bool {
+		a, b := markers[i].Span.Start, markers[j].Span.Start
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	width := len(strconv.Itoa(markers[len(markers)-1].Span.Start.Line))
+	gutter := strings.Repeat(" ", width)
+
+	lines := strings.Split(string(source), "\n")
+	line := func(number int) string {
+		if number > len(lines) {
+			return ""
+		}
+		return strings.TrimSuffix(lines[number-1], "\r")
+	}
+	writeLine := func(number int) {
+		text := line(number)
+		if text == "" {
+			sb.WriteString(r.style(blue, fmt.Sprintf("%*d |", width, number)) + "\n")
+			return
+		}
+		sb.WriteString(r.style(blue, fmt.Sprintf("%*d | ", width, number)) + text + "\n")
+	}
+
+	if name == "" {
+		name = "<input>"
+	}
+	sb.WriteString(gutter + r.style(blue, "--> ") + fmt.Sprintf("%s:%d:%d", name, d.Span.Start.Line, d.Span.Start.Column) + "\n")
+	sb.WriteString(r.style(blue, gutter+" |") + "\n")
+	previous := 0
+	for _, m := range markers {
+		number := m.Span.Start.Line
+		if number != previous {
+			switch {
+			case previous == 0 || number == previous+1:
+			case number == previous+2:
+				writeLine(previous + 1)
+			default:
+				sb.WriteString(r.style(blue, "...") + "\n")
+			}
+			writeLine(number)
+			previous = number
+		}
+		sb.WriteString(r.style(blue, gutter+" | ") + r.underline(line(number), m) + "\n")
+	}
+	r.writeFixes(&sb, gutter, d.Fixes)
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func (r Renderer) writeFixes(sb *strings.Builder, gutter string, fixes []Fix) {
+	for _, fix := range fixes {
+		sb.WriteString(gutter + r.style(blue, " = ") + r.style(bold, "help") + ": " + fix.Message + "\n")
+	}
+}
+
+// underline returns the markers under the span of m on text, the line that
+// the span starts on, followed by its message.
+func (r Renderer) underline(text string, m marker) string {
+	runes := []rune(text)
+	start, end := m.Span.Start, m.Span.End
+	var sb strings.Builder
+	for i := 0; i < start.Column-1; i++ {
+		// Tabs are copied so the markers line up however wide they are.
+		if i < len(runes) && runes[i] == '\t' {
+			sb.WriteRune('\t')
+		} else {
+			sb.WriteRune(' ')
+		}
+	}
+	length := 1
+	if end.Line == start.Line && end.Column > start.Column {
+		length = end.Column - start.Column
+	} else if end.Line > start.Line && len(runes)-start.Column+1 > 1 {
+		// Spans over several lines are underlined to the end of the first.
+		length = len(runes) - start.Column + 1
+	}
+	marks, color := strings.Repeat("^", length), red
+	if !m.primary {
+		marks, color = strings.Repeat("-", length), blue
+	}
+	if m.Message != "" {
+		marks += " " + m.Message
+	}
+	sb.WriteString(r.style(color, marks))
+	return sb.String()
+}
+
+func (r Renderer) style(code, text string) string {
+	if !r.Color {
+		return text
+	}
+	return code + text + reset
+}
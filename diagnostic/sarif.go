@@ -0,0 +1,154 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// SARIF is the Static Analysis Results Interchange Format, which code review
+// tools read to annotate changes. Only the parts of version 2.1.0 that
+// diagnostics need are written.
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId,omitempty"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations,omitempty"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+	Fixes            []sarifFix      `json:"fixes,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+type sarifFix struct {
+	Description     sarifMessage          `json:"description"`
+	ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Replacements     []sarifReplacement    `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   sarifRegion  `json:"deletedRegion"`
+	InsertedContent sarifMessage `json:"insertedContent"`
+}
+
+func newSARIFRegion(span Span) sarifRegion {
+	return sarifRegion{
+		StartLine:   span.Start.Line,
+		StartColumn: span.Start.Column,
+		EndLine:     span.End.Line,
+		EndColumn:   span.End.Column,
+	}
+}
+
+func newSARIFLocation(file string, span Span, message string) sarifLocation {
+	location := sarifLocation{
+		PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: file}},
+	}
+	if span.Start.Line > 0 {
+		region := newSARIFRegion(span)
+		location.PhysicalLocation.Region = &region
+	}
+	if message != "" {
+		location.Message = &sarifMessage{Text: message}
+	}
+	return location
+}
+
+// WriteSARIF writes the diagnostics of the files as a SARIF log from the tool
+// with the given name, with a rule for each diagnostic code.
+func WriteSARIF(w io.Writer, tool string, files []File) error {
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: tool, Rules: make([]sarifRule, 0)}},
+		Results: make([]sarifResult, 0),
+	}
+	rules := make(map[string]bool)
+	for _, file := range files {
+		for _, d := range file.Diagnostics {
+			if d.Code != "" && !rules[d.Code] {
+				rules[d.Code] = true
+				run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: d.Code})
+			}
+			result := sarifResult{
+				RuleID:    d.Code,
+				Level:     d.Severity.String(),
+				Message:   sarifMessage{Text: d.Message},
+				Locations: []sarifLocation{newSARIFLocation(file.Name, d.Span, "")},
+			}
+			for _, related := range d.Related {
+				result.RelatedLocations = append(result.RelatedLocations, newSARIFLocation(file.Name, related.Span, related.Message))
+			}
+			for _, fix := range d.Fixes {
+				change := sarifArtifactChange{ArtifactLocation: sarifArtifactLocation{URI: file.Name}}
+				for _, edit := range fix.Edits {
+					change.Replacements = append(change.Replacements, sarifReplacement{
+						DeletedRegion:   newSARIFRegion(edit.Span),
+						InsertedContent: sarifMessage{Text: edit.Text},
+					})
+				}
+				result.Fixes = append(result.Fixes, sarifFix{
+					Description:     sarifMessage{Text: fix.Message},
+					ArtifactChanges: []sarifArtifactChange{change},
+				})
+			}
+			run.Results = append(run.Results, result)
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{Version: sarifVersion, Schema: sarifSchema, Runs: []sarifRun{run}})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"brianhang.me/interpreter/doc"
+	"brianhang.me/interpreter/parser"
+)
+
+// runDoc writes a reference page for the top level bindings in the given
+// files, or stdin when there are none, returning the exit code for the command.
+func runDoc(args []string) int {
+	flags := flag.NewFlagSet("doc", flag.ContinueOnError)
+	format := flags.String("format", "markdown", "output format, either markdown or html")
+	title := flags.String("title", "", "title of the page, which defaults to the name of the first file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "markdown" && *format != "html" {
+		fmt.Fprintf(os.Stderr, "Unknown format %q, expected markdown or html\n", *format)
+		return 2
+	}
+
+	entries := make([]doc.Entry, 0)
+	addFile := func(name string, input io.Reader) bool {
+		file, err := parser.ParseFile(name, input, parser.Options{Comments: true})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			return false
+		}
+		entries = append(entries, doc.Extract(file.Nodes)...)
+		return true
+	}
+	if flags.NArg() == 0 {
+		if !addFile("<stdin>", os.Stdin) {
+			return 2
+		}
+	}
+	for _, name := range flags.Args() {
+		input, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read %s: %s\n", name, err)
+			return 2
+		}
+		ok := addFile(name, input)
+		input.Close()
+		if !ok {
+			return 2
+		}
+	}
+
+	if *title == "" {
+		*title = "Reference"
+		if flags.NArg() > 0 {
+			*title = strings.TrimSuffix(filepath.Base(flags.Arg(0)), filepath.Ext(flags.Arg(0)))
+		}
+	}
+	write := doc.Markdown
+	if *format == "html" {
+		write = doc.HTML
+	}
+	if err := write(os.Stdout, *title, entries); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write: %s\n", err)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,218 @@
+package doc
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"brianhang.me/interpreter/parser"
+	"brianhang.me/interpreter/printer"
+	"brianhang.me/interpreter/tokenize"
+)
+
+// Entry documents a binding declared at the top level of a program, or a
+// member of a class.
+type Entry struct {
+	// Kind is "class", "func", "let", "const" or "var" for a plain
+	// assignment.
+	Kind string
+	Name string
+	// Params are the parameters of a function, written as they are in source,
+	// such as "b = 2" or "...rest".
+	Params []string
+	Parent string
+	Doc    string
+	// Members are the fields and methods of a class.
+	Members []Entry
+	Pos     tokenize.Position
+}
+
+// Signature returns how the binding is declared, such as "func add(a, b)" or
+// "class Point < Base".
+func (e Entry) Signature() string {
+	switch e.Kind {
+	case "func":
+		return fmt.Sprintf("func %s(%s)", e.Name, strings.Join(e.Params, ", "))
+	case "class":
+		if e.Parent != "" {
+			return fmt.Sprintf("class %s < %s", e.Name, e.Parent)
+		}
+		return "class " + e.Name
+	case "var":
+		return e.Name
+	}
+	return e.Kind + " " + e.Name
+}
+
+// Extract returns the entries for the top level bindings of nodes, which
+// should have their doc comments attached by parser.AttachDocs. A name that is
+// bound more than once is listed at its first binding, with the first doc
+// comment of any of them. Compound assignments such as "x += 1" only update a
+// binding, so they are not listed.
+func Extract(nodes []parser.Node) []Entry {
+	entries := entryList{entries: make([]Entry, 0), byName: make(map[string]int)}
+	for _, node := range nodes {
+		for _, entry := range extract(node) {
+			entries.add(entry)
+		}
+	}
+	return entries.entries
+}
+
+// entryList holds entries with distinct names.
+type entryList struct {
+	entries []Entry
+	byName  map[string]int
+}
+
+func (l *entryList) add(entry Entry) {
+	if i, ok := l.byName[entry.Name]; ok {
+		if l.entries[i].Doc == "" {
+			l.entries[i].Doc = entry.Doc
+		}
+		return
+	}
+	l.byName[entry.Name] = len(l.entries)
+	l.entries = append(l.entries, entry)
+}
+
+func extract(node parser.Node) []Entry {
+	switch n := node.(type) {
+	case parser.ClassNode:
+		if n.Name.GetValue() != "" {
+			return []Entry{class(n.Name.GetValue(), n, n.Doc)}
+		}
+	case parser.FuncNode:
+		if n.Name.GetValue() != "" {
+			return []Entry{function(n.Name.GetValue(), n, n.Doc)}
+		}
+	case parser.LetNode:
+		return []Entry{{Kind: "let", Name: n.Name.GetValue(), Doc: parser.DocText(n.Doc), Pos: n.Pos()}}
+	case parser.ConstNode:
+		return []Entry{{Kind: "const", Name: n.Name.GetValue(), Doc: parser.DocText(n.Doc), Pos: n.Pos()}}
+	case parser.AssignmentNode:
+		if n.Equal.GetID() == tokenize.TokenEqual {
+			return []Entry{assignment(n)}
+		}
+	case parser.DestructureNode:
+		names := parser.PatternBindings(n.Pattern)
+		entries := make([]Entry, len(names))
+		for i, name := range names {
+			entries[i] = Entry{Kind: "var", Name: name.GetValue(), Pos: name.GetPos()}
+		}
+		return entries
+	}
+	return nil
+}
+
+func assignment(n parser.AssignmentNode) Entry {
+	name := n.LHS.String()
+	switch rhs := n.RHS.(type) {
+	case parser.FuncNode:
+		entry := function(name, rhs, n.Doc)
+		entry.Pos = n.Pos()
+		return entry
+	case parser.ClassNode:
+		entry := class(name, rhs, n.Doc)
+		entry.Pos = n.Pos()
+		return entry
+	}
+	return Entry{Kind: "var", Name: name, Doc: parser.DocText(n.Doc), Pos: n.Pos()}
+}
+
+func function(name string, n parser.FuncNode, docs []tokenize.CommentToken) Entry {
+	params := make([]string, len(n.Params))
+	for i, param := range n.Params {
+		switch {
+		case param.Ellipsis != nil:
+			params[i] = "..." + param.Name.GetValue()
+		case param.Default != nil:
+			params[i] = param.Name.GetValue() + " = " + source(param.Default)
+		default:
+			params[i] = param.Name.GetValue()
+		}
+	}
+	return Entry{Kind: "func", Name: name, Params: params, Doc: parser.DocText(docs), Pos: n.Pos()}
+}
+
+func class(name string, n parser.ClassNode, docs []tokenize.CommentToken) Entry {
+	entry := Entry{
+		Kind:   "class",
+		Name:   name,
+		Parent: n.ParentClass.GetValue(),
+		Doc:    parser.DocText(docs),
+		Pos:    n.Pos(),
+	}
+	members := entryList{entries: make([]Entry, 0, len(n.Body)), byName: make(map[string]int)}
+	for _, member := range n.Body {
+		members.add(assignment(member))
+	}
+	entry.Members = members.entries
+	return entry
+}
+
+func source(node parser.Node) string {
+	var sb strings.Builder
+	// Expressions from a parsed program can always be printed.
+	_ = printer.Fprint(&sb, []parser.Node{node})
+	return strings.TrimSpace(sb.String())
+}
+
+// Markdown writes the entries as a Markdown reference page.
+func Markdown(w io.Writer, title string, entries []Entry) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n", title)
+	for _, entry := range entries {
+		writeMarkdown(&sb, entry, "##")
+		for _, member := range entry.Members {
+			writeMarkdown(&sb, member, "###")
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func writeMarkdown(sb *strings.Builder, entry Entry, heading string) {
+	fmt.Fprintf(sb, "\n%s `%s`\n", heading, entry.Signature())
+	if entry.Doc != "" {
+		fmt.Fprintf(sb, "\n%s\n", entry.Doc)
+	}
+}
+
+var htmlPage = template.Must(template.New("page").Funcs(template.FuncMap{"paragraphs": paragraphs}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{range $entry := .Entries}}<section id="{{.Name}}">
+<h2><code>{{.Signature}}</code></h2>
+{{template "doc" .}}{{range .Members}}<h3 id="{{$entry.Name}}.{{.Name}}"><code>{{.Signature}}</code></h3>
+{{template "doc" .}}{{end}}</section>
+{{end}}</body>
+</html>
+{{define "doc"}}{{range paragraphs .Doc}}<p>{{.}}</p>
+{{end}}{{end}}`))
+
+// paragraphs splits documentation into the paragraphs separated by blank
+// lines.
+func paragraphs(doc string) []string {
+	result := make([]string, 0)
+	for _, paragraph := range strings.Split(doc, "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			result = append(result, paragraph)
+		}
+	}
+	return result
+}
+
+// HTML writes the entries as an HTML reference page.
+func HTML(w io.Writer, title string, entries []Entry) error {
+	return htmlPage.Execute(w, struct {
+		Title   string
+		Entries []Entry
+	}{title, entries})
+}
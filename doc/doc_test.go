@@ -0,0 +1,107 @@
+package doc
+
+import (
+	"strings"
+	"testing"
+
+	"brianhang.me/interpreter/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+const program = `/// Adds numbers.
+func add(a, b = 1 + 1, ...rest) { return a }
+
+/**
+ * A point.
+ *
+ * Has <coordinates>.
+ */
+class Point < Base {
+	/// The x coordinate.
+	x = 0
+	/// Moves the point.
+	move = func(dx) { }
+}
+
+let count
+/// The limit.
+const limit = 10
+double = func(n) { return n * 2 }
+print(limit)
+`
+
+func TestExtract(t *testing.T) {
+	file, err := parser.ParseString(program, parser.Options{Comments: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	entries := Extract(file.Nodes)
+	signatures := make([]string, len(entries))
+	for i, entry := range entries {
+		signatures[i] = entry.Signature()
+	}
+	assert.Equal(t, []string{
+		"func add(a, b = 1 + 1, ...rest)",
+		"class Point < Base",
+		"let count",
+		"const limit",
+		"func double(n)",
+	}, signatures)
+	assert.Equal(t, "A point.\n\nHas <coordinates>.", entries[1].Doc)
+	if assert.Len(t, entries[1].Members, 2) {
+		assert.Equal(t, "x", entries[1].Members[0].Signature())
+		assert.Equal(t, "The x coordinate.", entries[1].Members[0].Doc)
+		assert.Equal(t, "func move(dx)", entries[1].Members[1].Signature())
+	}
+	assert.Equal(t, 19, entries[4].Pos.Line)
+}
+
+func TestExtractBindings(t *testing.T) {
+	source := "x = 1\n/// The second x.\nx = 2\nx += 1\ny -= 1\n[a, {b}] = pair\nc, x = f()\nclass Foo { z = 1 z = 2 }"
+	file, err := parser.ParseString(source, parser.Options{Comments: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	entries := Extract(file.Nodes)
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name
+	}
+	assert.Equal(t, []string{"x", "a", "b", "c", "Foo"}, names)
+	assert.Equal(t, 1, entries[0].Pos.Line)
+	assert.Equal(t, "The second x.", entries[0].Doc)
+	assert.Equal(t, 6, entries[2].Pos.Line)
+	assert.Equal(t, 6, entries[2].Pos.Column)
+	assert.Len(t, entries[4].Members, 1)
+}
+
+func TestMarkdown(t *testing.T) {
+	file, err := parser.ParseString(program, parser.Options{Comments: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var sb strings.Builder
+	assert.NoError(t, Markdown(&sb, "math", Extract(file.Nodes)))
+	assert.Equal(t, "# math\n"+
+		"\n## `func add(a, b = 1 + 1, ...rest)`\n\nAdds numbers.\n"+
+		"\n## `class Point < Base`\n\nA point.\n\nHas <coordinates>.\n"+
+		"\n### `x`\n\nThe x coordinate.\n"+
+		"\n### `func move(dx)`\n\nMoves the point.\n"+
+		"\n## `let count`\n"+
+		"\n## `const limit`\n\nThe limit.\n"+
+		"\n## `func double(n)`\n", sb.String())
+}
+
+func TestHTML(t *testing.T) {
+	file, err := parser.ParseString(program, parser.Options{Comments: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var sb strings.Builder
+	assert.NoError(t, HTML(&sb, "math", Extract(file.Nodes)))
+	page := sb.String()
+	assert.Contains(t, page, "<title>math</title>")
+	assert.Contains(t, page, "<section id=\"Point\">\n<h2><code>class Point &lt; Base</code></h2>\n<p>A point.</p>\n<p>Has &lt;coordinates&gt;.</p>\n")
+	assert.Contains(t, page, "<h3 id=\"Point.move\"><code>func move(dx)</code></h3>\n<p>Moves the point.</p>\n")
+	assert.Contains(t, page, "<h2><code>func add(a, b = 1 &#43; 1, ...rest)</code></h2>")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"brianhang.me/interpreter/format"
+	"brianhang.me/interpreter/printer"
+)
+
+// runFmt formats the given files, or stdin when there are none, returning the
+// exit code for the command.
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	check := flags.Bool("check", false, "list files whose formatting differs and exit with 1 if there are any")
+	write := flags.Bool("w", false, "write the result to the file instead of stdout")
+	width := flags.Int("width", printer.DefaultWidth, "line width to wrap argument and parameter lists at")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read stdin: %s\n", err)
+			return 2
+		}
+		formatted, err := format.Source(source, *width)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "<stdin>: %s\n", err)
+			return 2
+		}
+		if *check {
+			if !bytes.Equal(source, formatted) {
+				fmt.Println("<stdin>")
+				return 1
+			}
+			return 0
+		}
+		os.Stdout.Write(formatted)
+		return 0
+	}
+
+	code := 0
+	for _, name := range flags.Args() {
+		source, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read %s: %s\n", name, err)
+			code = 2
+			continue
+		}
+		formatted, err := format.Source(source, *width)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			code = 2
+			continue
+		}
+		switch {
+		case *check:
+			if !bytes.Equal(source, formatted) {
+				fmt.Println(name)
+				if code == 0 {
+					code = 1
+				}
+			}
+		case *write:
+			if bytes.Equal(source, formatted) {
+				continue
+			}
+			if err := os.WriteFile(name, formatted, 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write %s: %s\n", name, err)
+				code = 2
+			}
+		default:
+			os.Stdout.Write(formatted)
+		}
+	}
+	return code
+}
@@ -0,0 +1,29 @@
+package format
+
+import (
+	"bytes"
+
+	"brianhang.me/interpreter/parser"
+	"brianhang.me/interpreter/printer"
+	"brianhang.me/interpreter/tokenize"
+)
+
+// Source reformats source in the canonical style, keeping its comments and
+// wrapping argument and parameter lists that don't fit in width columns.
+func Source(source []byte, width int) ([]byte, error) {
+	tokenizer := tokenize.NewTokenizer(bytes.NewReader(source))
+	tokens, err := tokenizer.Tokenize()
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := parser.NewParser(&tokens).Parse()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	config := printer.Config{Width: width, Comments: tokenizer.Comments()}
+	if err := config.Fprint(&buf, nodes); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
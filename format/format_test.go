@@ -0,0 +1,86 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSource(t *testing.T) {
+	cases := []struct {
+		source   string
+		width    int
+		expected string
+	}{
+		{"x=1+2*  3", 0, "x = 1 + 2 * 3\n"},
+		{"", 0, ""},
+		{
+			"// leading\n\n\nlet a = 1 // trailing\nlet b\n\n\n// before c\nc = a\n// end\n",
+			0,
+			"// leading\n\nlet a = 1 // trailing\nlet b\n\n// before c\nc = a\n// end\n",
+		},
+		{
+			"if (a) {\n  // inside\n  b()\n  // last\n}",
+			0,
+			"if (a) {\n\t// inside\n\tb()\n\t// last\n}\n",
+		},
+		{"f = func() {\n// only\n}", 0, "f = func() {\n\t// only\n}\n"},
+		{
+			"class Foo {\n// field\nx = 1 // one\n}\nm = match (x) { 1 => 2, // arm\n_ => 3 }",
+			0,
+			"class Foo {\n\t// field\n\tx = 1 // one\n}\nm = match (x) {\n\t1 => 2, // arm\n\t_ => 3,\n}\n",
+		},
+		{
+			"/**\n * Docs.\n */\n\n\nfunc f() { /* body */ }\n/// x\nx = 1",
+			0,
+			"/**\n * Docs.\n */\n\nfunc f() {\n\t/* body */\n}\n/// x\nx = 1\n",
+		},
+		{"x = 1 + /* mid */ 2\ny", 0, "x = 1 + /* mid */ 2\ny\n"},
+		{"if (a) { b } // c\nd", 0, "if (a) {\n\tb\n} // c\nd\n"},
+		{"f = func(a /* c */) { b }", 0, "f = func(a /* c */) {\n\tb\n}\n"},
+		{"f(a, // after a\n  b)", 0, "f(\n\ta, // after a\n\tb,\n)\n"},
+		{"f(a,\n// before b\nb)", 0, "f(\n\ta,\n\t// before b\n\tb,\n)\n"},
+		{"if (a) { b } // c\nelse { c }", 0, "if (a) {\n\tb\n} // c\nelse {\n\tc\n}\n"},
+		{"x = 1 + // c\n  2", 0, "x = 1 + // c\n2\n"},
+		{
+			"items.each(func(item) { print(a, // c\n b) })",
+			0,
+			"items.each(func(item) {\n\tprint(\n\t\ta, // c\n\t\tb,\n\t)\n})\n",
+		},
+		{"send(first, second, third,)", 0, "send(first, second, third)\n"},
+		{
+			"send(first, second, third)",
+			20,
+			"send(\n\tfirst,\n\tsecond,\n\tthird,\n)\n",
+		},
+		{
+			"outer(inner(alpha, beta), gamma)",
+			28,
+			"outer(\n\tinner(alpha, beta),\n\tgamma,\n)\n",
+		},
+		{
+			"items.each(func(item) { print(item) })",
+			24,
+			"items.each(func(item) {\n\tprint(item)\n})\n",
+		},
+		{
+			"func long(alpha, beta = 2, ...rest) { }",
+			24,
+			"func long(\n\talpha,\n\tbeta = 2,\n\t...rest,\n) {}\n",
+		},
+	}
+	for _, test := range cases {
+		formatted, err := Source([]byte(test.source), test.width)
+		if !assert.NoError(t, err, "Failed to format \"%s\"", test.source) {
+			continue
+		}
+		assert.Equal(t, test.expected, string(formatted))
+
+		again, err := Source(formatted, test.width)
+		assert.NoError(t, err)
+		assert.Equal(t, string(formatted), string(again), "Formatting \"%s\" is not idempotent", test.source)
+	}
+
+	_, err := Source([]byte("x = "), 0)
+	assert.Error(t, err)
+}
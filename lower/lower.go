@@ -0,0 +1,276 @@
+// Package lower rewrites parsed programs into a smaller core language for
+// backends to consume.
+//
+// The core language has no for loops, compound assignments, logical operators
+// or conditional expressions:
+//
+//   - A for loop becomes its initializer followed by a while loop, in a block
+//     that scopes the initializer. The update runs at the end of the loop's
+//     body, which is wrapped in a labeled do-while loop that runs once when
+//     the body continues the loop, so that a continue can break out of it to
+//     the update.
+//   - A compound assignment such as x += 1 becomes x = x + 1. The object of a
+//     field is only evaluated once, by binding it to a temporary with a
+//     BindNode when it is not a variable or this.
+//   - The logical operators and conditional expressions become a CondNode,
+//     with the left hand side of a logical operator bound to a temporary so it
+//     is only evaluated once. A conditional expression without an else is nil
+//     when its condition is falsy.
+//
+// Every node that is built keeps the span of the source that it was lowered
+// from, so that errors about lowered code point at what the user wrote. The
+// labels and temporaries that are introduced start with %, so they can't
+// conflict with names from the source. The core nodes are parser.ExtensionNodes
+// registered with parser.RegisterNode, so a lowered program can still be
+// rewritten with parser.Apply, compacted and encoded as JSON.
+package lower
+
+import (
+	"strconv"
+
+	"brianhang.me/interpreter/parser"
+	"brianhang.me/interpreter/tokenize"
+)
+
+// Lower returns the program in the core language.
+func Lower(nodes []parser.Node) []parser.Node {
+	l := &lowerer{}
+	return parser.ApplyList(nodes, l.pre, l.post)
+}
+
+type lowerer struct {
+	// statements holds whether each node being visited is a statement, as
+	// opposed to an expression whose value is used.
+	statements []bool
+	names      int
+}
+
+func (l *lowerer) pre(c *parser.Cursor) bool {
+	l.statements = append(l.statements, l.isStatement(c))
+	switch n := c.Node().(type) {
+	case parser.ForNode:
+		c.Replace(l.forLoop(n, tokenize.IdentifierToken{}))
+	case parser.LabeledNode:
+		if loop, ok := n.Body.(parser.ForNode); ok {
+			c.Replace(l.forLoop(loop, n.Label))
+		}
+	}
+	return true
+}
+
+func (l *lowerer) post(c *parser.Cursor) bool {
+	statement := l.statements[len(l.statements)-1]
+	l.statements = l.statements[:len(l.statements)-1]
+	switch n := c.Node().(type) {
+	case parser.AssignmentNode:
+		if operator, ok := parser.CompoundOperator(n.Equal); ok {
+			c.Replace(parser.AssignmentNode{
+				LHS:   n.LHS,
+				Equal: tokenize.NewToken(tokenize.TokenEqual, n.Equal.GetPos(), n.Equal.GetEnd()),
+				RHS:   binary(parser.LiteralNode{Value: n.LHS}, operator, n.Equal, n.RHS),
+			})
+		}
+	case parser.SetNode:
+		if operator, ok := parser.CompoundOperator(n.Equal); ok {
+			c.Replace(l.bind(n.Object, func(object parser.ExpressionNode) parser.ExpressionNode {
+				return parser.SetNode{
+					Object: object,
+					Key:    n.Key,
+					Equal:  tokenize.NewToken(tokenize.TokenEqual, n.Equal.GetPos(), n.Equal.GetEnd()),
+					RHS:    binary(parser.LookupNode{Value: object, Key: n.Key}, operator, n.Equal, n.RHS),
+				}
+			}))
+		}
+	case parser.LogicalExprNode:
+		c.Replace(l.logical(n, n.LHS, n.Operator, n.RHS))
+	case parser.BinaryExprNode:
+		// The parser builds the logical operators as binary expressions.
+		switch n.Operator.GetID() {
+		case tokenize.TokenAnd, tokenize.TokenOr:
+			c.Replace(l.logical(n, n.LHS, n.Operator, n.RHS))
+		}
+	case parser.ConditionalNode:
+		if statement {
+			break
+		}
+		cond := CondNode{Condition: n.Condition, Then: n.TrueBody, Else: n.FalseBody, First: n.GetStartToken(), Last: n.GetEndToken()}
+		if cond.Else == nil {
+			cond.Else = parser.LiteralNode{
+				Value: tokenize.NewIdentifierToken(tokenize.TokenNil, "", n.If.GetPos(), n.If.GetEnd()),
+			}
+		}
+		c.Replace(cond)
+	}
+	return true
+}
+
+func (l *lowerer) logical(n parser.Node, lhs parser.ExpressionNode, operator tokenize.TokenHolder, rhs parser.ExpressionNode) parser.ExpressionNode {
+	return l.bind(lhs, func(value parser.ExpressionNode) parser.ExpressionNode {
+		if operator.GetID() == tokenize.TokenOr {
+			return CondNode{Condition: value, Then: value, Else: rhs, First: n.GetStartToken(), Last: n.GetEndToken()}
+		}
+		return CondNode{Condition: value, Then: rhs, Else: value, First: n.GetStartToken(), Last: n.GetEndToken()}
+	})
+}
+
+// isStatement reports whether the value of the node at c is unused.
+func (l *lowerer) isStatement(c *parser.Cursor) bool {
+	switch c.Parent().(type) {
+	case nil, parser.BlockNode:
+		return true
+	case parser.WhileNode, parser.DoWhileNode, parser.ForInNode, parser.LabeledNode:
+		return c.Name() == "Body"
+	case parser.TryNode:
+		return c.Name() == "FinallyBody"
+	case parser.ConditionalNode:
+		parent := l.statements[len(l.statements)-1]
+		return parent && (c.Name() == "TrueBody" || c.Name() == "FalseBody")
+	}
+	return false
+}
+
+// bind passes value to build, binding it to a temporary first unless it can
+// be evaluated more than once without side effects.
+func (l *lowerer) bind(value parser.ExpressionNode, build func(parser.ExpressionNode) parser.ExpressionNode) parser.ExpressionNode {
+	switch value.(type) {
+	case parser.LiteralNode, parser.ThisNode:
+		return build(value)
+	}
+	name := tokenize.NewIdentifierToken(tokenize.TokenIdentifier, l.name("%t"), value.Pos(), value.End())
+	return BindNode{Name: name, Value: value, Body: build(parser.LiteralNode{Value: name})}
+}
+
+func (l *lowerer) name(prefix string) string {
+	l.names++
+	return prefix + strconv.Itoa(l.names)
+}
+
+func binary(lhs parser.ExpressionNode, operator tokenize.TokenID, at tokenize.TokenHolder, rhs parser.ExpressionNode) parser.BinaryExprNode {
+	return parser.BinaryExprNode{
+		LHS:      lhs,
+		Operator: tokenize.NewToken(operator, at.GetPos(), at.GetEnd()),
+		RHS:      rhs,
+	}
+}
+
+// forLoop lowers a for loop, which has the given label when it is not empty.
+func (l *lowerer) forLoop(n parser.ForNode, label tokenize.IdentifierToken) parser.StatementNode {
+	forPos, forEnd := n.For.GetPos(), n.For.GetEnd()
+	condition := n.Condition
+	if condition == nil {
+		condition = parser.LiteralNode{Value: tokenize.NewIdentifierToken(tokenize.TokenTrue, "", forPos, forEnd)}
+	}
+
+	body := n.Body
+	if n.Update != nil && continuesLoop(body, label.GetValue()) {
+		// Breaks out of the loop have to name it, since they are now inside of
+		// the do-while loop.
+		if label.GetValue() == "" {
+			label = tokenize.NewIdentifierToken(tokenize.TokenIdentifier, l.name("%loop"), forPos, forEnd)
+		}
+		start, end := body.GetStartToken(), body.GetEndToken()
+		bodyLabel := tokenize.NewIdentifierToken(tokenize.TokenIdentifier, l.name("%body"), start.GetPos(), start.GetEnd())
+		body = parser.LabeledNode{
+			Label: bodyLabel,
+			Body: parser.DoWhileNode{
+				Do:         tokenize.NewIdentifierToken(tokenize.TokenDo, "", start.GetPos(), start.GetEnd()),
+				Body:       retarget(body, label, bodyLabel),
+				While:      tokenize.NewIdentifierToken(tokenize.TokenWhile, "", end.GetPos(), end.GetEnd()),
+				Condition:  parser.LiteralNode{Value: tokenize.NewIdentifierToken(tokenize.TokenFalse, "", end.GetPos(), end.GetEnd())},
+				RightParen: end,
+			},
+		}
+	}
+	if n.Update != nil {
+		body = parser.BlockNode{
+			BodyStart: body.GetStartToken().GetToken(),
+			Children:  []parser.StatementNode{body, n.Update},
+			BodyEnd:   body.GetEndToken().GetToken(),
+		}
+	}
+
+	var loop parser.StatementNode = parser.WhileNode{
+		While:     tokenize.NewIdentifierToken(tokenize.TokenWhile, "", forPos, forEnd),
+		Condition: condition,
+		Body:      body,
+	}
+	if label.GetValue() != "" {
+		loop = parser.LabeledNode{Label: label, Body: loop}
+	}
+	if n.Init == nil {
+		return loop
+	}
+	return parser.BlockNode{
+		BodyStart: loop.GetStartToken().GetToken(),
+		Children:  []parser.StatementNode{n.Init, loop},
+		BodyEnd:   loop.GetEndToken().GetToken(),
+	}
+}
+
+// continuesLoop reports whether body has a continue for the loop holding it,
+// which has the given label when it is not empty.
+func continuesLoop(body parser.StatementNode, label string) bool {
+	found := false
+	visitJumps(body, func(c *parser.Cursor, nested bool) {
+		if n, ok := c.Node().(parser.ContinueNode); ok {
+			name := n.Label.GetValue()
+			found = found || name == "" && !nested || name != "" && name == label
+		}
+	})
+	return found
+}
+
+// retarget rewrites the jumps in the body of a lowered for loop, which is in a
+// do-while loop labeled bodyLabel inside of the loop labeled label. Continuing
+// the loop breaks out of the do-while loop instead, and breaking out of the
+// loop has to name it.
+func retarget(body parser.StatementNode, label, bodyLabel tokenize.IdentifierToken) parser.StatementNode {
+	return visitJumps(body, func(c *parser.Cursor, nested bool) {
+		switch n := c.Node().(type) {
+		case parser.ContinueNode:
+			name := n.Label.GetValue()
+			if name == "" && !nested || name == label.GetValue() {
+				c.Replace(parser.BreakNode{
+					Break: tokenize.NewIdentifierToken(tokenize.TokenBreak, "", n.Continue.GetPos(), n.Continue.GetEnd()),
+					Label: tokenize.NewIdentifierToken(tokenize.TokenIdentifier, bodyLabel.GetValue(), n.Pos(), n.End()),
+				})
+			}
+		case parser.BreakNode:
+			if n.Label.GetValue() == "" && !nested {
+				n.Label = tokenize.NewIdentifierToken(tokenize.TokenIdentifier, label.GetValue(), n.Break.GetPos(), n.Break.GetEnd())
+				c.Replace(n)
+			}
+		}
+	})
+}
+
+// visitJumps calls visit for the breaks and continues in body, saying whether
+// they are nested in a loop inside of it. It doesn't go into
+// functions and classes, which jumps can't leave.
+func visitJumps(body parser.StatementNode, visit func(c *parser.Cursor, nested bool)) parser.StatementNode {
+	depth := 0
+	isLoop := func(node parser.Node) bool {
+		switch node.(type) {
+		case parser.WhileNode, parser.DoWhileNode, parser.ForNode, parser.ForInNode:
+			return true
+		}
+		return false
+	}
+	return parser.Apply(body, func(c *parser.Cursor) bool {
+		switch c.Node().(type) {
+		case parser.FuncNode, parser.ClassNode:
+			return false
+		case parser.BreakNode, parser.ContinueNode:
+			visit(c, depth > 0)
+		}
+		if isLoop(c.Node()) {
+			depth++
+		}
+		return true
+	}, func(c *parser.Cursor) bool {
+		if isLoop(c.Node()) {
+			depth--
+		}
+		return true
+	})
+}
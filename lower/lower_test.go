@@ -0,0 +1,143 @@
+package lower
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"brianhang.me/interpreter/parser"
+	"brianhang.me/interpreter/tokenize"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLower(t *testing.T) {
+	cases := []struct {
+		source   string
+		expected string
+	}{
+		{
+			"for (let i = 0; i < 3; i = i + 1) print(i)",
+			"[(block [(let i (number 0)) (while (< (identifier i) (number 3)) (block [(call (identifier print) (identifier i)) (= i (+ (identifier i) (number 1)))]))])]",
+		},
+		{
+			"for (;;) { break }",
+			"[(while (true ) (block [(break)]))]",
+		},
+		{
+			"for (i = 0; i < n; i += 1) { if (skip(i)) continue while (a) { continue } break }",
+			"[(block [(= i (number 0)) (label %loop1 (while (< (identifier i) (identifier n)) (block [(label %body2 (do (block [(if (call (identifier skip) (identifier i)) (break %body2)) (while (identifier a) (block [(continue)])) (break %loop1)]) while (false ))) (= i (+ (identifier i) (number 1)))])))])]",
+		},
+		{
+			"outer: for (;; step()) { for (x in xs) { continue outer } } for (;; step()) { continue }",
+			"[(label outer (while (true ) (block [(label %body1 (do (block [(for-in x (identifier xs) (block [(break %body1)]))]) while (false ))) (call (identifier step))]))) (label %loop2 (while (true ) (block [(label %body3 (do (block [(break %body3)]) while (false ))) (call (identifier step))])))]",
+		},
+		{
+			"f = func() { for (;; g()) { if (h()) return } }",
+			"[(= f (func (block [(while (true ) (block [(block [(if (call (identifier h)) (return nil))]) (call (identifier g))]))])))]",
+		},
+		{
+			"x += 1 a.b -= 2 f().c *= d",
+			"[(= x (+ (identifier x) (number 1))) (set (identifier a) b (- (lookup (identifier a) b) (number 2))) (bind %t1 (call (identifier f)) (set (identifier %t1) c (* (lookup (identifier %t1) c) (identifier d))))]",
+		},
+		{
+			"y = a and b or c",
+			"[(= y (bind %t1 (cond (identifier a) (identifier b) (identifier a)) (cond (identifier %t1) (identifier %t1) (identifier c))))]",
+		},
+		{
+			"y = f() and g()",
+			"[(= y (bind %t1 (call (identifier f)) (cond (identifier %t1) (call (identifier g)) (identifier %t1))))]",
+		},
+		{
+			"y = (if (a) b else if (c) d) z = (if (e) f)",
+			"[(= y (cond (identifier a) (identifier b) (cond (identifier c) (identifier d) (nil )))) (= z (cond (identifier e) (identifier f) (nil )))]",
+		},
+		{
+			"if (a) b else if (c) d",
+			"[(if (identifier a) (identifier b) else (if (identifier c) (identifier d)))]",
+		},
+	}
+	for _, test := range cases {
+		assert.Equal(t, test.expected, fmt.Sprintf("%s", Lower(parse(t, test.source))), "Lowered \"%s\"", test.source)
+	}
+}
+
+func TestLowerSpans(t *testing.T) {
+	source := "x = 1\nfor (let i = 0; i < 3; i += 1) {\n\tx = f() or x\n}"
+	nodes := parse(t, source)
+	lowered := Lower(nodes)
+	assert.Equal(t, nodes[1].Pos(), lowered[1].Pos())
+	assert.Equal(t, nodes[1].End(), lowered[1].End())
+
+	loop := lowered[1].(parser.BlockNode).Children[1].(parser.WhileNode)
+	assert.Equal(t, tokenize.Position{Line: 2, Column: 1}, loop.While.GetPos())
+	update := loop.Body.(parser.BlockNode).Children[1].(parser.AssignmentNode)
+	assert.Equal(t, tokenize.Position{Line: 2, Column: 26}, update.Equal.GetPos())
+	assert.Equal(t, tokenize.Position{Line: 2, Column: 26}, update.RHS.(parser.BinaryExprNode).Operator.GetPos())
+	assert.Equal(t, tokenize.Position{Line: 2, Column: 24}, update.RHS.Pos())
+	assert.Equal(t, tokenize.Position{Line: 2, Column: 30}, update.RHS.End())
+
+	body := loop.Body.(parser.BlockNode).Children[0].(parser.BlockNode)
+	or := body.Children[0].(parser.AssignmentNode).RHS.(BindNode)
+	assert.Equal(t, tokenize.Position{Line: 3, Column: 6}, or.Pos())
+	assert.Equal(t, tokenize.Position{Line: 3, Column: 14}, or.End())
+	assert.Equal(t, or.Value.Pos(), or.Name.GetPos())
+	cond := or.Body.(CondNode)
+	assert.Equal(t, or.Pos(), cond.Pos())
+	assert.Equal(t, or.End(), cond.End())
+}
+
+func TestLoweredTree(t *testing.T) {
+	for _, source := range []string{
+		// Lowering builds tokens at the positions of the source tokens that
+		// they replace, which the arena must keep apart.
+		"x += 1 a.b -= 2",
+		"for (i = 0; i < n; i += 1) { if (skip(i)) continue }",
+		"y = a and b or c z = (if (a) b) f().c *= d",
+	} {
+		lowered := Lower(parse(t, source))
+		expected := fmt.Sprintf("%s", lowered)
+
+		renamed := parser.ApplyList(lowered, func(c *parser.Cursor) bool {
+			if literal, ok := c.Node().(parser.LiteralNode); ok && literal.Value.String() == "a" {
+				c.Replace(parser.LiteralNode{Value: tokenize.NewIdentifierToken(tokenize.TokenIdentifier, "q", literal.Pos(), literal.End())})
+			}
+			return true
+		}, nil)
+		assert.Equal(t, strings.ReplaceAll(expected, "(identifier a)", "(identifier q)"), fmt.Sprintf("%s", renamed), "Applied to \"%s\"", source)
+
+		var applied, inspected []parser.Node
+		parser.ApplyList(lowered, func(c *parser.Cursor) bool {
+			applied = append(applied, c.Node())
+			return true
+		}, nil)
+		for _, node := range lowered {
+			parser.Inspect(node, func(n parser.Node) bool {
+				if n != nil {
+					inspected = append(inspected, n)
+				}
+				return n != nil
+			})
+		}
+		assert.Equal(t, applied, inspected, "Inspected \"%s\"", source)
+
+		assert.Equal(t, expected, fmt.Sprintf("%s", parser.Compact(lowered).Nodes()), "Compacted \"%s\"", source)
+		data, err := parser.MarshalJSON(lowered)
+		if assert.NoError(t, err) {
+			decoded, err := parser.UnmarshalJSON(data)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, fmt.Sprintf("%s", decoded), "Decoded \"%s\"", source)
+		}
+	}
+}
+
+func parse(t *testing.T, source string) []parser.Node {
+	tokens, err := tokenize.NewTokenizer(strings.NewReader(source)).Tokenize()
+	if err != nil {
+		t.Fatalf("Failed to tokenize \"%s\": %s", source, err)
+	}
+	nodes, err := parser.NewParser(&tokens).Parse()
+	if err != nil {
+		t.Fatalf("Failed to parse \"%s\": %s", source, err)
+	}
+	return nodes
+}
@@ -0,0 +1,80 @@
+package lower
+
+import (
+	"fmt"
+
+	"brianhang.me/interpreter/parser"
+	"brianhang.me/interpreter/tokenize"
+)
+
+// CondNode is the core form of conditional expressions and the logical
+// operators. It evaluates Condition, and then either Then when it is truthy or
+// Else otherwise.
+type CondNode struct {
+	Condition parser.ExpressionNode
+	Then      parser.ExpressionNode
+	Else      parser.ExpressionNode
+	// First and Last are the first and last tokens of the source that the
+	// node was lowered from.
+	First tokenize.TokenHolder
+	Last  tokenize.TokenHolder
+}
+
+// BindNode evaluates Value once and binds it to Name, a temporary that can't
+// be written in source, for the evaluation of Body. The value of Body is the
+// value of the node.
+type BindNode struct {
+	Name  tokenize.IdentifierToken
+	Value parser.ExpressionNode
+	Body  parser.ExpressionNode
+}
+
+func init() {
+	parser.RegisterNode("Cond", CondNode{})
+	parser.RegisterNode("Bind", BindNode{})
+}
+
+func (n CondNode) ApplyChildren(apply func(name string, child parser.Node) parser.Node) parser.Node {
+	n.Condition = apply("Condition", n.Condition)
+	n.Then = apply("Then", n.Then)
+	n.Else = apply("Else", n.Else)
+	return n
+}
+
+func (n BindNode) ApplyChildren(apply func(name string, child parser.Node) parser.Node) parser.Node {
+	n.Value = apply("Value", n.Value)
+	n.Body = apply("Body", n.Body)
+	return n
+}
+
+func (n CondNode) GetStartToken() tokenize.TokenHolder {
+	return n.First
+}
+func (n CondNode) GetEndToken() tokenize.TokenHolder {
+	return n.Last
+}
+func (n CondNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n CondNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n CondNode) String() string {
+	return fmt.Sprintf("(cond %s %s %s)", n.Condition, n.Then, n.Else)
+}
+
+func (n BindNode) GetStartToken() tokenize.TokenHolder {
+	return n.Value.GetStartToken()
+}
+func (n BindNode) GetEndToken() tokenize.TokenHolder {
+	return n.Body.GetEndToken()
+}
+func (n BindNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n BindNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n BindNode) String() string {
+	return fmt.Sprintf("(bind %s %s %s)", n.Name.GetValue(), n.Value, n.Body)
+}
@@ -1,24 +1,124 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 
+	"brianhang.me/interpreter/diagnostic"
 	"brianhang.me/interpreter/parser"
-	"brianhang.me/interpreter/tokenize"
+)
+
+// The exit codes of the interpreter, so that scripts can tell why it failed.
+const (
+	exitSuccess    = 0
+	exitUsage      = 2
+	exitLexError   = 3
+	exitParseError = 4
 )
 
 func main() {
-	tokenizer := tokenize.NewTokenizer(os.Stdin)
-	tokens, err := tokenizer.Tokenize()
-	if err != nil {
-		fmt.Printf("Failed to tokenize: %s\n", err)
-		return
-	}
-	parser := parser.NewParser(&tokens)
-	nodes, err := parser.Parse()
-	if err != nil {
-		fmt.Printf("Failed to parse: %s\n", err)
-	}
-	fmt.Printf("%s\n", nodes)
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		os.Exit(runFmt(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "doc" {
+		os.Exit(runDoc(os.Args[2:]))
+	}
+	os.Exit(run(os.Args[1:]))
+}
+
+// run parses the given files, or stdin when there are none, printing their
+// ASTs and the diagnostics for any errors, and returns the exit code.
+func run(args []string) int {
+	flags := flag.NewFlagSet("interpreter", flag.ContinueOnError)
+	format := flags.String("format", "text", "how to print diagnostics, either text, json or sarif")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: interpreter [-format text|json|sarif] [file ...]\n")
+		flags.PrintDefaults()
+		fmt.Fprintf(flags.Output(), "\nExits with %d for errors from the tokenizer and %d for errors from the parser.\n", exitLexError, exitParseError)
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *format != "text" && *format != "json" && *format != "sarif" {
+		fmt.Fprintf(os.Stderr, "Unknown format %q, expected text, json or sarif\n", *format)
+		return exitUsage
+	}
+
+	names := flags.Args()
+	if len(names) == 0 {
+		names = []string{"<stdin>"}
+	}
+	renderer := diagnostic.Renderer{Color: diagnostic.IsTerminal(os.Stderr)}
+	files := make([]diagnostic.File, 0, len(names))
+	code := exitSuccess
+	for _, name := range names {
+		var source []byte
+		var err error
+		if name == "<stdin>" {
+			source, err = io.ReadAll(os.Stdin)
+		} else {
+			source, err = os.ReadFile(name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read %s: %s\n", name, err)
+			return exitUsage
+		}
+
+		file, err := parser.ParseFile(name, bytes.NewReader(source), parser.Options{Recover: true})
+		_, isParseError := err.(parser.ErrorList)
+		isLexError := err != nil && !isParseError
+		if isLexError {
+			// The parser collects its errors in an ErrorList when recovering,
+			// so any other error is from the tokenizer.
+			code = exitLexError
+		} else if err == nil {
+			err = parser.Resolve(file.Nodes)
+		}
+		if err != nil && code == exitSuccess {
+			code = exitParseError
+		}
+		// Warnings are reported without changing the exit code.
+		diagnostics := append(diagnose(err), diagnose(parser.ErrorList(file.Warnings))...)
+		files = append(files, diagnostic.File{Name: name, Diagnostics: diagnostics})
+		if *format != "text" {
+			continue
+		}
+		for _, d := range diagnostics {
+			renderer.Render(os.Stderr, name, source, d)
+		}
+		if !isLexError {
+			fmt.Printf("%s\n", file.Nodes)
+		}
+	}
+
+	switch *format {
+	case "json":
+		diagnostic.WriteJSON(os.Stdout, files)
+	case "sarif":
+		diagnostic.WriteSARIF(os.Stdout, "interpreter", files)
+	}
+	return code
+}
+
+// diagnose returns the diagnostics for err, which may be an ErrorList.
+func diagnose(err error) []diagnostic.Diagnostic {
+	if err == nil {
+		return nil
+	}
+	if list, ok := err.(parser.ErrorList); ok {
+		diagnostics := make([]diagnostic.Diagnostic, 0, len(list))
+		for _, err := range list {
+			diagnostics = append(diagnostics, diagnose(err)...)
+		}
+		return diagnostics
+	}
+	var d *diagnostic.Diagnostic
+	if !errors.As(err, &d) {
+		return []diagnostic.Diagnostic{{Message: err.Error()}}
+	}
+	return []diagnostic.Diagnostic{*d}
 }
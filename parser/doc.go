@@ -0,0 +1,151 @@
+package parser
+
+import (
+	"strings"
+
+	"brianhang.me/interpreter/tokenize"
+)
+
+// AttachDocs sets the Doc field of the classes, functions, assignments, lets
+// and consts that start on the line right after a doc comment, returning the
+// rewritten nodes. A run of /// comments on consecutive lines documents the
+// same declaration. A doc comment must be alone on its lines, except that a
+// /** */ comment can also come right before the declaration on its line.
+// When declarations start on the same line, such as an assignment of a
+// function, the comment goes to the outermost one.
+func AttachDocs(nodes []Node, comments []tokenize.CommentToken) []Node {
+	code := codeColumns(nodes)
+	byEndLine := make(map[int]int)
+	for i, comment := range comments {
+		if comment.IsDoc() && !code.before(comment.GetPos()) {
+			byEndLine[comment.GetEnd().Line] = i
+		}
+	}
+	docFor := func(node Node) []tokenize.CommentToken {
+		pos := node.Pos()
+		last, ok := byEndLine[pos.Line]
+		if ok && isBefore(comments[last].GetPos(), pos) && !code.between(comments[last].GetEnd(), pos) {
+			delete(byEndLine, pos.Line)
+			return []tokenize.CommentToken{comments[last]}
+		}
+		last, ok = byEndLine[pos.Line-1]
+		if !ok || code.after(comments[last].GetEnd()) {
+			return nil
+		}
+		delete(byEndLine, pos.Line-1)
+		first := last
+		for first > 0 && isLineDoc(comments[first]) && isLineDoc(comments[first-1]) &&
+			comments[first-1].GetLine() == comments[first].GetLine()-1 &&
+			!code.before(comments[first-1].GetPos()) {
+			first--
+		}
+		return append([]tokenize.CommentToken(nil), comments[first:last+1]...)
+	}
+	return ApplyList(nodes, func(c *Cursor) bool {
+		switch n := c.Node().(type) {
+		case ClassNode:
+			n.Doc = docFor(n)
+			c.Replace(n)
+		case FuncNode:
+			n.Doc = docFor(n)
+			c.Replace(n)
+		case AssignmentNode:
+			n.Doc = docFor(n)
+			c.Replace(n)
+		case LetNode:
+			n.Doc = docFor(n)
+			c.Replace(n)
+		case ConstNode:
+			n.Doc = docFor(n)
+			c.Replace(n)
+		}
+		return true
+	}, nil)
+}
+
+// lineColumns holds the columns on each line where the first and last tokens
+// of nodes start and end, which is enough to tell whether a comment shares a
+// line with code.
+type lineColumns struct {
+	starts map[int][]int
+	ends   map[int][]int
+}
+
+func codeColumns(nodes []Node) lineColumns {
+	code := lineColumns{starts: make(map[int][]int), ends: make(map[int][]int)}
+	add := func(token tokenize.TokenHolder) {
+		if token == nil {
+			return
+		}
+		pos, end := token.GetPos(), token.GetEnd()
+		code.starts[pos.Line] = append(code.starts[pos.Line], pos.Column)
+		code.ends[end.Line] = append(code.ends[end.Line], end.Column)
+	}
+	for _, node := range nodes {
+		Inspect(node, func(n Node) bool {
+			if n != nil {
+				add(n.GetStartToken())
+				add(n.GetEndToken())
+			}
+			return n != nil
+		})
+	}
+	return code
+}
+
+// before reports whether code ends on the line of pos before it.
+func (c lineColumns) before(pos tokenize.Position) bool {
+	for _, column := range c.ends[pos.Line] {
+		if column <= pos.Column {
+			return true
+		}
+	}
+	return false
+}
+
+// after reports whether code starts on the line of pos after it.
+func (c lineColumns) after(pos tokenize.Position) bool {
+	for _, column := range c.starts[pos.Line] {
+		if column >= pos.Column {
+			return true
+		}
+	}
+	return false
+}
+
+// between reports whether code starts on the line of from and to, at or after
+// from and before to.
+func (c lineColumns) between(from tokenize.Position, to tokenize.Position) bool {
+	for _, column := range c.starts[from.Line] {
+		if column >= from.Column && column < to.Column {
+			return true
+		}
+	}
+	return false
+}
+
+func isLineDoc(comment tokenize.CommentToken) bool {
+	return comment.IsDoc() && strings.HasPrefix(comment.GetValue(), "///")
+}
+
+// DocText returns the text of doc comments without their delimiters, along
+// with the leading * on each line of a block comment.
+func DocText(comments []tokenize.CommentToken) string {
+	lines := make([]string, 0, len(comments))
+	for _, comment := range comments {
+		value := comment.GetValue()
+		if strings.HasPrefix(value, "///") {
+			lines = append(lines, strings.TrimPrefix(value[3:], " "))
+			continue
+		}
+		value = strings.TrimSuffix(strings.TrimPrefix(value, "/**"), "*/")
+		for _, line := range strings.Split(value, "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "*") {
+				line = strings.TrimPrefix(line[1:], " ")
+			}
+			lines = append(lines, line)
+		}
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
@@ -2,51 +2,255 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 
+	"brianhang.me/interpreter/diagnostic"
 	"brianhang.me/interpreter/tokenize"
 )
 
+// The codes of the diagnostics for parser errors. Syntax errors start with E2,
+// errors found by Resolve with E3 and errors decoding JSON with E4. Warnings
+// about code that parses but was likely meant differently start with W2.
+const (
+	CodeUnexpectedToken           = "E201"
+	CodeExpectedToken             = "E202"
+	CodeExpectedStatement         = "E203"
+	CodeExpectedExpression        = "E204"
+	CodeInvalidAssignmentTarget   = "E205"
+	CodeNoValue                   = "E206"
+	CodeInvalidFuncParam          = "E207"
+	CodeOutsideClass              = "E208"
+	CodeOutsideLoop               = "E209"
+	CodeUndefinedLabel            = "E210"
+	CodeInvalidLabel              = "E211"
+	CodeRequiredParamAfterDefault = "E212"
+	CodeVariadicParamNotLast      = "E213"
+	CodeDuplicateName             = "E214"
+	CodePositionalArgAfterNamed   = "E215"
+	CodeTooDeeplyNested           = "E216"
+	CodeUnsupportedVersion        = "E217"
+	CodeNoParentClass             = "E218"
+	CodeAssignmentMismatch        = "E219"
+	CodeUndeclaredAssignment      = "E301"
+	CodeConstAssignment           = "E302"
+	CodeRedeclaration             = "E303"
+	CodeNonExhaustiveMatch        = "E304"
+	CodeJSONVersion               = "E401"
+	CodeJSONSchema                = "E402"
+	CodeAssignmentInCondition     = "W201"
+	CodeKeywordTypo               = "W202"
+)
+
 type UnexpectedTokenError struct {
-	token tokenize.TokenHolder
+	token    tokenize.TokenHolder
+	expected []tokenize.TokenID
 }
 
 func (e *UnexpectedTokenError) Error() string {
 	token := e.token
-	return fmt.Sprintf(
+	message := fmt.Sprintf(
 		"Unexpected token \"%s\" on line %d at column %d",
-		token.String(),
+		tokenName(token),
 		token.GetLine(),
 		token.GetColumn(),
 	)
+	if expected := describeTokens(e.expected); len(expected) > 0 {
+		message += ", expected " + joinOr(expected)
+	}
+	return message
+}
+
+func (e *UnexpectedTokenError) Diagnostic() diagnostic.Diagnostic {
+	label := "unexpected token"
+	if expected := describeTokens(e.expected); len(expected) > 0 {
+		label = "expected " + joinOr(expected)
+	}
+	return diagnostic.Diagnostic{
+		Code:    CodeUnexpectedToken,
+		Message: e.Error(),
+		Span:    tokenSpan(e.token),
+		Label:   label,
+	}
+}
+
+func (e *UnexpectedTokenError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+// Keywords are identifier tokens without a value, so they are named by their
+// token ID instead.
+func tokenName(token tokenize.TokenHolder) string {
+	if name := token.String(); name != "" {
+		return name
+	}
+	return token.GetID().String()
 }
 
 type ExpectedTokenError struct {
-	expected tokenize.TokenID
+	// expected starts with the token that was required, followed by the
+	// others that would have been valid in its place.
+	expected []tokenize.TokenID
 	actual   tokenize.TokenHolder
 	last     tokenize.TokenHolder
+	// opening is the token left unclosed when the expected token closes it.
+	opening tokenize.TokenHolder
+	// typo is an identifier that was probably meant to be the suggestion
+	// keyword.
+	typo       tokenize.TokenHolder
+	suggestion tokenize.TokenID
 }
 
 func (e *ExpectedTokenError) Error() string {
+	expected := e.describe()
+	if expected == fmt.Sprintf("\"%s\"", e.expected[0]) {
+		expected = "token " + expected
+	}
+	var message string
 	actual := e.actual
 	if actual == nil {
 		last := e.last
 		if last == nil {
-			return fmt.Sprintf("Expected token \"%s\"", e.expected)
+			message = fmt.Sprintf("Expected %s", expected)
+		} else {
+			message = fmt.Sprintf(
+				"Expected %s near line %d and column %d",
+				expected,
+				last.GetLine(),
+				last.GetColumn(),
+			)
 		}
-		return fmt.Sprintf(
-			"Expected token \"%s\" near line %d and column %d",
-			e.expected,
-			last.GetLine(),
-			last.GetColumn(),
+	} else {
+		message = fmt.Sprintf(
+			"Expected %s, but got \"%s\" instead on line %d at column %d",
+			expected,
+			actual,
+			actual.GetLine(),
+			actual.GetColumn(),
 		)
 	}
-	return fmt.Sprintf(
-		"Expected token \"%s\", but got \"%s\" instead on line %d at column %d",
-		e.expected,
-		actual,
-		actual.GetLine(),
-		actual.GetColumn(),
-	)
+	if opening := e.opening; opening != nil {
+		message += fmt.Sprintf(
+			" for the \"%s\" opened on line %d at column %d",
+			opening.GetID(),
+			opening.GetLine(),
+			opening.GetColumn(),
+		)
+	}
+	if e.typo != nil {
+		message += fmt.Sprintf(", did you mean \"%s\" instead of \"%s\"?", e.suggestion, e.typo)
+	}
+	return message
+}
+
+func (e *ExpectedTokenError) Diagnostic() diagnostic.Diagnostic {
+	d := diagnostic.Diagnostic{
+		Code:    CodeExpectedToken,
+		Message: e.Error(),
+		Label:   "expected " + e.describe(),
+	}
+	switch {
+	case e.actual != nil:
+		d.Span = tokenSpan(e.actual)
+	case e.typo != nil:
+		d.Span = tokenSpan(e.typo)
+		d.Label = fmt.Sprintf("did you mean \"%s\"?", e.suggestion)
+		d.Fixes = append(d.Fixes, diagnostic.Fix{
+			Message: fmt.Sprintf("Replace \"%s\" with \"%s\"", e.typo, e.suggestion),
+			Edits:   []diagnostic.Edit{{Span: d.Span, Text: e.suggestion.String()}},
+		})
+	default:
+		d.Span = afterSpan(e.last)
+	}
+	if e.opening != nil {
+		d.Related = append(d.Related, diagnostic.Label{
+			Span:    tokenSpan(e.opening),
+			Message: fmt.Sprintf("unclosed \"%s\" opened here", e.opening.GetID()),
+		})
+		if closing := closingTokenIDs[e.opening.GetID()]; closing == e.expected[0] && len(d.Fixes) == 0 {
+			d.Fixes = append(d.Fixes, diagnostic.Fix{
+				Message: fmt.Sprintf("Insert \"%s\"", closing),
+				Edits:   []diagnostic.Edit{{Span: afterSpan(e.last), Text: closing.String()}},
+			})
+		}
+	}
+	return d
+}
+
+var closingTokenIDs = map[tokenize.TokenID]tokenize.TokenID{
+	tokenize.TokenLeftParen:   tokenize.TokenRightParen,
+	tokenize.TokenLeftCurly:   tokenize.TokenRightCurly,
+	tokenize.TokenLeftBracket: tokenize.TokenRightBracket,
+}
+
+func (e *ExpectedTokenError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+// describe lists the expected tokens, such as "\")\" or an operator".
+func (e *ExpectedTokenError) describe() string {
+	return joinOr(append([]string{fmt.Sprintf("\"%s\"", e.expected[0])}, describeTokens(e.expected[1:])...))
+}
+
+var binaryOperatorTokenIDs = func() []tokenize.TokenID {
+	var ids []tokenize.TokenID
+	for _, operators := range [][]tokenize.TokenID{
+		factorOperatorTokenIDs,
+		termOperatorTokenIDs,
+		comparisonOperatorTokenIDs,
+		equalityOperatorTokenIDs,
+		conjunctionOperatorTokenIDs,
+		disjunctionOperatorTokenIDs,
+	} {
+		ids = append(ids, operators...)
+	}
+	return ids
+}()
+
+// describeTokens names the expected tokens for an error. Since the start of
+// an expression and the binary operators are checked for one token at a time,
+// they are named as "an expression" and "an operator" instead. Semicolons
+// between statements are optional, so they are left out too.
+func describeTokens(ids []tokenize.TokenID) []string {
+	names := make([]string, 0, len(ids))
+	isExpression, isOperator := false, false
+	for _, id := range ids {
+		switch {
+		case containsToken(atomicTokenIDs, id):
+			isExpression = true
+		case containsToken(unaryOperatorTokenIDs, id):
+			// Minus is also a binary operator, but both are checked for
+			// along with the others in their group.
+		case containsToken(binaryOperatorTokenIDs, id):
+			isOperator = true
+		case id == tokenize.TokenSemicolon:
+		default:
+			names = append(names, fmt.Sprintf("\"%s\"", id))
+		}
+	}
+	if isOperator {
+		names = append(names, "an operator")
+	}
+	if isExpression {
+		names = append(names, "an expression")
+	}
+	return names
+}
+
+func containsToken(ids []tokenize.TokenID, id tokenize.TokenID) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+	return false
+}
+
+// joinOr joins names as a list such as "a, b or c".
+func joinOr(names []string) string {
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
 }
 
 type ExpectedStatementError struct {
@@ -63,6 +267,19 @@ func (e *ExpectedStatementError) Error() string {
 	}
 	return fmt.Sprintf("Expected a statement near line %d", last.GetLine())
 }
+
+func (e *ExpectedStatementError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeExpectedStatement,
+		Message: e.Error(),
+		Span:    afterSpan(e.last),
+		Label:   "expected a statement",
+	}
+}
+
+func (e *ExpectedStatementError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
 func (e *ExpectedExpressionError) Error() string {
 	last := e.last
 	if last == nil {
@@ -71,17 +288,136 @@ func (e *ExpectedExpressionError) Error() string {
 	return fmt.Sprintf("Expected an expression near line %d", last.GetLine())
 }
 
+func (e *ExpectedExpressionError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeExpectedExpression,
+		Message: e.Error(),
+		Span:    afterSpan(e.last),
+		Label:   "expected an expression",
+	}
+}
+
+func (e *ExpectedExpressionError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
 type InvalidAssignmentTargetError struct {
 	target tokenize.TokenHolder
+	equal  tokenize.TokenHolder
+	// comparison is whether the assignment is the condition of an if or a
+	// loop, where "==" was probably meant.
+	comparison bool
 }
 
 func (e *InvalidAssignmentTargetError) Error() string {
 	target := e.target
-	return fmt.Sprintf(
+	message := fmt.Sprintf(
 		"Invalid left hand side for assignment on line %d at column %d",
 		target.GetLine(),
 		target.GetColumn(),
 	)
+	if e.comparison {
+		message += fmt.Sprintf(
+			", did you mean \"%s\" instead of \"%s\" on line %d at column %d?",
+			tokenize.TokenEqualEqual,
+			e.equal.GetID(),
+			e.equal.GetLine(),
+			e.equal.GetColumn(),
+		)
+	}
+	return message
+}
+
+func (e *InvalidAssignmentTargetError) Diagnostic() diagnostic.Diagnostic {
+	d := diagnostic.Diagnostic{
+		Code:    CodeInvalidAssignmentTarget,
+		Message: e.Error(),
+		Span:    tokenSpan(e.target),
+		Label:   "cannot be assigned to",
+	}
+	if e.comparison {
+		d.Related = append(d.Related, diagnostic.Label{
+			Span:    tokenSpan(e.equal),
+			Message: fmt.Sprintf("did you mean \"%s\"?", tokenize.TokenEqualEqual),
+		})
+		d.Fixes = append(d.Fixes, diagnostic.Fix{
+			Message: fmt.Sprintf("Compare with \"%s\"", tokenize.TokenEqualEqual),
+			Edits:   []diagnostic.Edit{{Span: tokenSpan(e.equal), Text: tokenize.TokenEqualEqual.String()}},
+		})
+	}
+	return d
+}
+
+func (e *InvalidAssignmentTargetError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+// AssignmentInConditionWarning is an assignment that makes up the condition of
+// an if or a loop, where a comparison was probably meant.
+type AssignmentInConditionWarning struct {
+	equal tokenize.TokenHolder
+}
+
+func (e *AssignmentInConditionWarning) Error() string {
+	return fmt.Sprintf(
+		"Assignment used as a condition on line %d at column %d, did you mean \"%s\"?",
+		e.equal.GetLine(),
+		e.equal.GetColumn(),
+		tokenize.TokenEqualEqual,
+	)
+}
+
+func (e *AssignmentInConditionWarning) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Severity: diagnostic.SeverityWarning,
+		Code:     CodeAssignmentInCondition,
+		Message:  e.Error(),
+		Span:     tokenSpan(e.equal),
+		Label:    fmt.Sprintf("did you mean \"%s\"?", tokenize.TokenEqualEqual),
+		Fixes: []diagnostic.Fix{{
+			Message: fmt.Sprintf("Compare with \"%s\"", tokenize.TokenEqualEqual),
+			Edits:   []diagnostic.Edit{{Span: tokenSpan(e.equal), Text: tokenize.TokenEqualEqual.String()}},
+		}},
+	}
+}
+
+func (e *AssignmentInConditionWarning) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+// KeywordTypoWarning is a name starting a statement that was probably meant to
+// be a keyword, such as "fucn" in "fucn f() {}".
+type KeywordTypoWarning struct {
+	name    tokenize.TokenHolder
+	keyword tokenize.TokenID
+}
+
+func (e *KeywordTypoWarning) Error() string {
+	return fmt.Sprintf(
+		"Unknown name \"%s\" on line %d at column %d, did you mean \"%s\"?",
+		e.name,
+		e.name.GetLine(),
+		e.name.GetColumn(),
+		e.keyword,
+	)
+}
+
+func (e *KeywordTypoWarning) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Severity: diagnostic.SeverityWarning,
+		Code:     CodeKeywordTypo,
+		Message:  e.Error(),
+		Span:     tokenSpan(e.name),
+		Label:    fmt.Sprintf("did you mean \"%s\"?", e.keyword),
+		Fixes: []diagnostic.Fix{{
+			Message: fmt.Sprintf("Replace \"%s\" with \"%s\"", e.name, e.keyword),
+			Edits:   []diagnostic.Edit{{Span: tokenSpan(e.name), Text: e.keyword.String()}},
+		}},
+	}
+}
+
+func (e *KeywordTypoWarning) As(target interface{}) bool {
+	return diagnostic.As(e, target)
 }
 
 type NoValueError struct {
@@ -100,6 +436,19 @@ func (e *NoValueError) Error() string {
 	)
 }
 
+func (e *NoValueError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeNoValue,
+		Message: e.Error(),
+		Span:    afterSpan(e.last),
+		Label:   "expected a value",
+	}
+}
+
+func (e *NoValueError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
 type InvalidFuncParamError struct {
 	actual Node
 }
@@ -113,3 +462,512 @@ func (e *InvalidFuncParamError) Error() string {
 		token.GetColumn(),
 	)
 }
+
+func (e *InvalidFuncParamError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeInvalidFuncParam,
+		Message: e.Error(),
+		Span:    nodeSpan(e.actual),
+		Label:   "expected an identifier",
+	}
+}
+
+func (e *InvalidFuncParamError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type OutsideClassError struct {
+	token tokenize.TokenHolder
+}
+
+func (e *OutsideClassError) Error() string {
+	token := e.token
+	return fmt.Sprintf(
+		"Cannot use \"%s\" outside of a class body on line %d at column %d",
+		token.GetID(),
+		token.GetLine(),
+		token.GetColumn(),
+	)
+}
+
+func (e *OutsideClassError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeOutsideClass,
+		Message: e.Error(),
+		Span:    tokenSpan(e.token),
+		Label:   "outside of a class",
+	}
+}
+
+func (e *OutsideClassError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type NoParentClassError struct {
+	token tokenize.TokenHolder
+}
+
+func (e *NoParentClassError) Error() string {
+	token := e.token
+	return fmt.Sprintf(
+		"Cannot use \"%s\" in a class without a parent class on line %d at column %d",
+		token.GetID(),
+		token.GetLine(),
+		token.GetColumn(),
+	)
+}
+
+func (e *NoParentClassError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeNoParentClass,
+		Message: e.Error(),
+		Span:    tokenSpan(e.token),
+		Label:   "class has no parent",
+	}
+}
+
+func (e *NoParentClassError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type AssignmentMismatchError struct {
+	assignment Node
+	targets    int
+	values     []ExpressionNode
+}
+
+func (e *AssignmentMismatchError) Error() string {
+	start := e.assignment.Pos()
+	return fmt.Sprintf(
+		"Assignment on line %d at column %d has %s",
+		start.Line,
+		start.Column,
+		e.counts(),
+	)
+}
+
+func (e *AssignmentMismatchError) counts() string {
+	targets := "targets"
+	if e.targets == 1 {
+		targets = "target"
+	}
+	return fmt.Sprintf("%d %s but %d values", e.targets, targets, len(e.values))
+}
+
+func (e *AssignmentMismatchError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeAssignmentMismatch,
+		Message: e.Error(),
+		Span:    diagnostic.Span{Start: e.assignment.Pos(), End: e.values[len(e.values)-1].End()},
+		Label:   e.counts(),
+	}
+}
+
+func (e *AssignmentMismatchError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type UndeclaredAssignmentError struct {
+	name tokenize.IdentifierToken
+}
+
+func (e *UndeclaredAssignmentError) Error() string {
+	name := e.name
+	return fmt.Sprintf(
+		"Cannot assign to undeclared variable \"%s\" on line %d at column %d",
+		name.GetValue(),
+		name.GetLine(),
+		name.GetColumn(),
+	)
+}
+
+func (e *UndeclaredAssignmentError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeUndeclaredAssignment,
+		Message: e.Error(),
+		Span:    tokenSpan(e.name),
+		Label:   "not declared",
+	}
+}
+
+func (e *UndeclaredAssignmentError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type ConstAssignmentError struct {
+	name        tokenize.IdentifierToken
+	declaration tokenize.IdentifierToken
+}
+
+func (e *ConstAssignmentError) Error() string {
+	name := e.name
+	return fmt.Sprintf(
+		"Cannot assign to constant \"%s\" on line %d at column %d, it was declared on line %d",
+		name.GetValue(),
+		name.GetLine(),
+		name.GetColumn(),
+		e.declaration.GetLine(),
+	)
+}
+
+func (e *ConstAssignmentError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeConstAssignment,
+		Message: e.Error(),
+		Span:    tokenSpan(e.name),
+		Label:   "cannot assign to a constant",
+		Related: []diagnostic.Label{{Span: tokenSpan(e.declaration), Message: "declared as a constant here"}},
+	}
+}
+
+func (e *ConstAssignmentError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type RedeclarationError struct {
+	name        tokenize.IdentifierToken
+	declaration tokenize.IdentifierToken
+}
+
+func (e *RedeclarationError) Error() string {
+	name := e.name
+	return fmt.Sprintf(
+		"\"%s\" on line %d at column %d is already declared in this scope on line %d",
+		name.GetValue(),
+		name.GetLine(),
+		name.GetColumn(),
+		e.declaration.GetLine(),
+	)
+}
+
+func (e *RedeclarationError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeRedeclaration,
+		Message: e.Error(),
+		Span:    tokenSpan(e.name),
+		Label:   "already declared",
+		Related: []diagnostic.Label{{Span: tokenSpan(e.declaration), Message: "first declared here"}},
+	}
+}
+
+func (e *RedeclarationError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type OutsideLoopError struct {
+	token tokenize.TokenHolder
+}
+
+func (e *OutsideLoopError) Error() string {
+	token := e.token
+	return fmt.Sprintf(
+		"Cannot use \"%s\" outside of a loop on line %d at column %d",
+		token.GetID(),
+		token.GetLine(),
+		token.GetColumn(),
+	)
+}
+
+func (e *OutsideLoopError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeOutsideLoop,
+		Message: e.Error(),
+		Span:    tokenSpan(e.token),
+		Label:   "outside of a loop",
+	}
+}
+
+func (e *OutsideLoopError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type UndefinedLabelError struct {
+	label tokenize.IdentifierToken
+}
+
+func (e *UndefinedLabelError) Error() string {
+	label := e.label
+	return fmt.Sprintf(
+		"Undefined label \"%s\" on line %d at column %d",
+		label.GetValue(),
+		label.GetLine(),
+		label.GetColumn(),
+	)
+}
+
+func (e *UndefinedLabelError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeUndefinedLabel,
+		Message: e.Error(),
+		Span:    tokenSpan(e.label),
+		Label:   "undefined label",
+	}
+}
+
+func (e *UndefinedLabelError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type InvalidLabelError struct {
+	label tokenize.IdentifierToken
+}
+
+func (e *InvalidLabelError) Error() string {
+	label := e.label
+	return fmt.Sprintf(
+		"Label \"%s\" on line %d at column %d must be followed by a loop",
+		label.GetValue(),
+		label.GetLine(),
+		label.GetColumn(),
+	)
+}
+
+func (e *InvalidLabelError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeInvalidLabel,
+		Message: e.Error(),
+		Span:    tokenSpan(e.label),
+		Label:   "not followed by a loop",
+	}
+}
+
+func (e *InvalidLabelError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type RequiredParamAfterDefaultError struct {
+	param ParamNode
+}
+
+func (e *RequiredParamAfterDefaultError) Error() string {
+	name := e.param.Name
+	return fmt.Sprintf(
+		"Parameter \"%s\" on line %d at column %d needs a default value since it follows a parameter with one",
+		name.GetValue(),
+		name.GetLine(),
+		name.GetColumn(),
+	)
+}
+
+func (e *RequiredParamAfterDefaultError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeRequiredParamAfterDefault,
+		Message: e.Error(),
+		Span:    nodeSpan(e.param),
+		Label:   "needs a default value",
+	}
+}
+
+func (e *RequiredParamAfterDefaultError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type VariadicParamNotLastError struct {
+	param ParamNode
+}
+
+func (e *VariadicParamNotLastError) Error() string {
+	name := e.param.Name
+	return fmt.Sprintf(
+		"Variadic parameter \"%s\" on line %d at column %d must be the last parameter",
+		name.GetValue(),
+		name.GetLine(),
+		name.GetColumn(),
+	)
+}
+
+func (e *VariadicParamNotLastError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeVariadicParamNotLast,
+		Message: e.Error(),
+		Span:    nodeSpan(e.param),
+		Label:   "must be the last parameter",
+	}
+}
+
+func (e *VariadicParamNotLastError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type DuplicateNameError struct {
+	name     tokenize.IdentifierToken
+	previous tokenize.IdentifierToken
+}
+
+func (e *DuplicateNameError) Error() string {
+	name := e.name
+	return fmt.Sprintf(
+		"Duplicate name \"%s\" on line %d at column %d, it was already used on line %d at column %d",
+		name.GetValue(),
+		name.GetLine(),
+		name.GetColumn(),
+		e.previous.GetLine(),
+		e.previous.GetColumn(),
+	)
+}
+
+func (e *DuplicateNameError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeDuplicateName,
+		Message: e.Error(),
+		Span:    tokenSpan(e.name),
+		Label:   "duplicate name",
+		Related: []diagnostic.Label{{Span: tokenSpan(e.previous), Message: "first used here"}},
+	}
+}
+
+func (e *DuplicateNameError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type PositionalArgAfterNamedError struct {
+	arg ArgNode
+}
+
+func (e *PositionalArgAfterNamedError) Error() string {
+	start := e.arg.GetStartToken()
+	return fmt.Sprintf(
+		"Positional argument on line %d at column %d cannot follow a named argument",
+		start.GetLine(),
+		start.GetColumn(),
+	)
+}
+
+func (e *PositionalArgAfterNamedError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodePositionalArgAfterNamed,
+		Message: e.Error(),
+		Span:    nodeSpan(e.arg),
+		Label:   "follows a named argument",
+	}
+}
+
+func (e *PositionalArgAfterNamedError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type NonExhaustiveMatchError struct {
+	match tokenize.IdentifierToken
+}
+
+func (e *NonExhaustiveMatchError) Error() string {
+	match := e.match
+	return fmt.Sprintf(
+		"Match on line %d at column %d checks for class instances, but has no arm for other values",
+		match.GetLine(),
+		match.GetColumn(),
+	)
+}
+
+func (e *NonExhaustiveMatchError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeNonExhaustiveMatch,
+		Message: e.Error(),
+		Span:    tokenSpan(e.match),
+		Label:   "missing an arm for other values",
+	}
+}
+
+func (e *NonExhaustiveMatchError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type JSONVersionError struct {
+	version int
+}
+
+func (e *JSONVersionError) Error() string {
+	return fmt.Sprintf("Unsupported JSON AST version %d, expected version %d", e.version, JSONVersion)
+}
+
+func (e *JSONVersionError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{Code: CodeJSONVersion, Message: e.Error()}
+}
+
+func (e *JSONVersionError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type JSONSchemaError struct {
+	path    string
+	message string
+}
+
+func (e *JSONSchemaError) Error() string {
+	return fmt.Sprintf("Invalid JSON AST at %s: %s", e.path, e.message)
+}
+
+func (e *JSONSchemaError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{Code: CodeJSONSchema, Message: e.Error()}
+}
+
+func (e *JSONSchemaError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type UnsupportedVersionError struct {
+	version int
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("Unsupported language version %d, the latest version is %d", e.version, LatestVersion)
+}
+
+func (e *UnsupportedVersionError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{Code: CodeUnsupportedVersion, Message: e.Error()}
+}
+
+func (e *UnsupportedVersionError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type TooDeeplyNestedError struct {
+	token    tokenize.TokenHolder
+	maxDepth int
+}
+
+func (e *TooDeeplyNestedError) Error() string {
+	token := e.token
+	if token == nil {
+		return fmt.Sprintf("Source is nested more than %d levels deep", e.maxDepth)
+	}
+	return fmt.Sprintf(
+		"Source is nested more than %d levels deep on line %d at column %d",
+		e.maxDepth,
+		token.GetLine(),
+		token.GetColumn(),
+	)
+}
+
+func (e *TooDeeplyNestedError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeTooDeeplyNested,
+		Message: e.Error(),
+		Span:    tokenSpan(e.token),
+		Label:   "nested too deeply",
+	}
+}
+
+func (e *TooDeeplyNestedError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+func tokenSpan(token tokenize.TokenHolder) diagnostic.Span {
+	if token == nil {
+		return diagnostic.Span{}
+	}
+	return diagnostic.Span{Start: token.GetPos(), End: token.GetEnd()}
+}
+
+func nodeSpan(node Node) diagnostic.Span {
+	return diagnostic.Span{Start: node.Pos(), End: node.End()}
+}
+
+// afterSpan returns the empty span right after token, where a missing token
+// would go.
+func afterSpan(token tokenize.TokenHolder) diagnostic.Span {
+	if token == nil {
+		return diagnostic.Span{}
+	}
+	return diagnostic.Span{Start: token.GetEnd(), End: token.GetEnd()}
+}
@@ -0,0 +1,128 @@
+package parser
+
+import "fmt"
+
+// Inspect traverses a syntax tree in depth-first order without copying or
+// changing it, which makes it cheaper than Apply for read-only queries. It
+// starts by calling f(node). If that returns true, Inspect is called for each
+// of the non-nil children of node, in the order Apply visits them, followed by
+// a call of f(nil). An ArenaNode is visited as the node it rebuilds.
+func Inspect(node Node, f func(Node) bool) {
+	if arena, ok := node.(ArenaNode); ok {
+		node = arena.Node()
+	}
+	if node == nil || !f(node) {
+		return
+	}
+	switch n := node.(type) {
+	case ConditionalNode:
+		Inspect(n.Condition, f)
+		Inspect(n.TrueBody, f)
+		Inspect(n.FalseBody, f)
+	case WhileNode:
+		Inspect(n.Condition, f)
+		Inspect(n.Body, f)
+	case DoWhileNode:
+		Inspect(n.Body, f)
+		Inspect(n.Condition, f)
+	case ForNode:
+		Inspect(n.Init, f)
+		Inspect(n.Condition, f)
+		Inspect(n.Update, f)
+		Inspect(n.Body, f)
+	case ForInNode:
+		Inspect(n.Collection, f)
+		Inspect(n.Body, f)
+	case LabeledNode:
+		Inspect(n.Body, f)
+	case BlockNode:
+		for _, child := range n.Children {
+			Inspect(child, f)
+		}
+	case AssignmentNode:
+		Inspect(n.RHS, f)
+	case DestructureNode:
+		Inspect(n.Pattern, f)
+		for _, value := range n.Values {
+			Inspect(value, f)
+		}
+	case ArrayPatternNode:
+		for _, element := range n.Elements {
+			Inspect(element, f)
+		}
+	case TuplePatternNode:
+		for _, element := range n.Elements {
+			Inspect(element, f)
+		}
+	case ClassPatternNode:
+		Inspect(n.Fields, f)
+	case IdentifierPatternNode, MapPatternNode, LiteralPatternNode, WildcardPatternNode:
+	case MatchNode:
+		Inspect(n.Value, f)
+		for _, arm := range n.Arms {
+			Inspect(arm, f)
+		}
+	case MatchArmNode:
+		Inspect(n.Pattern, f)
+		Inspect(n.Guard, f)
+		Inspect(n.Body, f)
+	case SetNode:
+		Inspect(n.Object, f)
+		Inspect(n.RHS, f)
+	case CallNode:
+		Inspect(n.Function, f)
+		for _, arg := range n.Args {
+			Inspect(arg, f)
+		}
+	case ArgNode:
+		Inspect(n.Value, f)
+	case FuncNode:
+		for _, param := range n.Params {
+			Inspect(param, f)
+		}
+		Inspect(n.Body, f)
+	case ParamNode:
+		Inspect(n.Default, f)
+	case ReturnNode:
+		Inspect(n.Value, f)
+	case ThrowNode:
+		Inspect(n.Value, f)
+	case TryNode:
+		Inspect(n.Body, f)
+		for _, catch := range n.Catches {
+			Inspect(catch, f)
+		}
+		Inspect(n.FinallyBody, f)
+	case CatchNode:
+		Inspect(n.Body, f)
+	case LetNode:
+		Inspect(n.Value, f)
+	case ConstNode:
+		Inspect(n.Value, f)
+	case ClassNode:
+		for _, field := range n.Body {
+			Inspect(field, f)
+		}
+	case LogicalExprNode:
+		Inspect(n.LHS, f)
+		Inspect(n.RHS, f)
+	case BinaryExprNode:
+		Inspect(n.LHS, f)
+		Inspect(n.RHS, f)
+	case UnaryExprNode:
+		Inspect(n.Operand, f)
+	case LookupNode:
+		Inspect(n.Value, f)
+	case GroupNode:
+		Inspect(n.Expression, f)
+	case BreakNode, ContinueNode, ThisNode, SuperNode, LiteralNode:
+	case ExtensionNode:
+		n.ApplyChildren(func(_ string, child Node) Node {
+			Inspect(child, f)
+			return child
+		})
+	default:
+		panic(fmt.Sprintf("Inspect: unexpected node type %T", n))
+	}
+	f(nil)
+}
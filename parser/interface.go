@@ -0,0 +1,184 @@
+package parser
+
+import (
+	"io"
+	"strings"
+
+	"brianhang.me/interpreter/tokenize"
+)
+
+// LatestVersion is the newest version of the language that can be parsed.
+// There is only one version so far, so Options.Version is checked to be in
+// range but doesn't change the syntax that is accepted.
+const LatestVersion = 1
+
+type Options struct {
+	// Recover keeps parsing after a syntax error by skipping to the start of
+	// the next statement. All of the errors are returned as an ErrorList along
+	// with the statements that did parse.
+	Recover bool
+	// Comments keeps the comments from the source in File.Comments and
+	// attaches doc comments to the declarations after them with AttachDocs.
+	Comments bool
+	// Version is the language version to parse, or LatestVersion when zero.
+	Version int
+	// MaxDepth is how deeply the source can nest, or DefaultMaxDepth when
+	// zero.
+	MaxDepth int
+	// Limits bound the size of the source and how many tokens it can have.
+	Limits tokenize.Limits
+}
+
+type File struct {
+	Name     string
+	Nodes    []Node
+	Comments []tokenize.CommentToken
+	// Warnings hold the diagnostics for code that parses but was probably
+	// meant differently, such as "if (x = 1)".
+	Warnings []error
+}
+
+// ErrorList holds every error found when parsing with Options.Recover.
+type ErrorList []error
+
+func (e ErrorList) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+func ParseFile(name string, input io.Reader, options Options) (*File, error) {
+	file := &File{Name: name}
+	if options.Version < 0 || options.Version > LatestVersion {
+		return file, &UnsupportedVersionError{version: options.Version}
+	}
+	tokenizer := tokenize.NewTokenizer(input)
+	tokenizer.SetLimits(options.Limits)
+	tokens, err := tokenizer.Tokenize()
+	if options.Comments {
+		file.Comments = tokenizer.Comments()
+	}
+	if err != nil {
+		return file, err
+	}
+	p := options.newParser(&tokens)
+	if options.Recover {
+		file.Nodes, err = p.parseRecovering()
+	} else {
+		file.Nodes, err = p.Parse()
+	}
+	file.Warnings = p.Warnings()
+	if options.Comments {
+		file.Nodes = AttachDocs(file.Nodes, file.Comments)
+	}
+	return file, err
+}
+
+func ParseString(source string, options Options) (*File, error) {
+	return ParseFile("", strings.NewReader(source), options)
+}
+
+// ParseExpression parses source as exactly one expression, such as a formula
+// entered by a user, and fails if anything follows it.
+func ParseExpression(source string) (ExpressionNode, error) {
+	return ParseExpressionWith(source, Options{})
+}
+
+// ParseExpressionWith is like ParseExpression, but parses with the version and
+// limits in options. Recover and Comments don't apply to an expression and
+// are ignored.
+func ParseExpressionWith(source string, options Options) (ExpressionNode, error) {
+	if options.Version < 0 || options.Version > LatestVersion {
+		return nil, &UnsupportedVersionError{version: options.Version}
+	}
+	tokenizer := tokenize.NewTokenizer(strings.NewReader(source))
+	tokenizer.SetLimits(options.Limits)
+	tokens, err := tokenizer.Tokenize()
+	if err != nil {
+		return nil, err
+	}
+	p := options.newParser(&tokens)
+	expression, err := p.expression()
+	if err != nil {
+		return expression, err
+	}
+	if trailing := p.peek(); trailing != nil {
+		return expression, &UnexpectedTokenError{token: trailing}
+	}
+	return expression, nil
+}
+
+func (options Options) newParser(tokens *[]tokenize.TokenHolder) *Parser {
+	p := NewParser(tokens)
+	if options.MaxDepth > 0 {
+		p.maxDepth = options.MaxDepth
+	}
+	return p
+}
+
+func (p *Parser) parseRecovering() ([]Node, error) {
+	statements := make([]Node, 0)
+	var errors ErrorList
+	for {
+		start := p.curTokenIdx
+		statement, err := p.maybeStatement()
+		if err != nil {
+			errors = append(errors, err)
+			p.synchronize(start)
+			if p.peek() == nil || p.curTokenIdx == start {
+				break
+			}
+			continue
+		}
+		if statement == nil {
+			break
+		}
+		statements = append(statements, statement)
+		p.statementSeparator()
+	}
+	if len(errors) > 0 {
+		return statements, errors
+	}
+	return statements, nil
+}
+
+var statementStartTokenIDs = map[tokenize.TokenID]bool{
+	tokenize.TokenLet:      true,
+	tokenize.TokenConst:    true,
+	tokenize.TokenClass:    true,
+	tokenize.TokenFunc:     true,
+	tokenize.TokenIf:       true,
+	tokenize.TokenWhile:    true,
+	tokenize.TokenDo:       true,
+	tokenize.TokenFor:      true,
+	tokenize.TokenReturn:   true,
+	tokenize.TokenBreak:    true,
+	tokenize.TokenContinue: true,
+	tokenize.TokenThrow:    true,
+	tokenize.TokenTry:      true,
+}
+
+// synchronize skips past the statement that failed to parse, stopping after
+// a semicolon or closing curly brace, or before a token that starts a new line
+// or a statement.
+func (p *Parser) synchronize(start int) {
+	p.depth = 0
+	p.classes = nil
+	p.loopLabels = nil
+	p.pendingLabel = ""
+	if p.curTokenIdx == start {
+		p.consume()
+	}
+	for token := p.peek(); token != nil; token = p.peek() {
+		last := p.last()
+		switch {
+		case last.GetID() == tokenize.TokenSemicolon || last.GetID() == tokenize.TokenRightCurly:
+			return
+		case token.GetLine() > last.GetLine() || statementStartTokenIDs[token.GetID()]:
+			return
+		}
+		p.consume()
+	}
+}
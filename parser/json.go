@@ -0,0 +1,601 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"brianhang.me/interpreter/tokenize"
+)
+
+// JSONVersion is the version of the JSON AST format written by MarshalJSON.
+// It is bumped whenever a change to the format could break existing readers,
+// such as renaming or removing a node kind or field.
+//
+// A document is an object holding the version and the top level nodes:
+//
+//	{"version": 1, "nodes": [node, ...]}
+//
+// Every node is an object with its kind, which is the name of its Go type
+// without the "Node" suffix, and the span of source it covers. The rest of its
+// keys are the names of the Go struct fields, in declaration order:
+//
+//	{"kind": "Assignment", "pos": position, "end": position, "LHS": token, ...}
+//
+// Fields hold a node, a token, an array of either, or null when they are
+// absent. Positions are 1-based and the end position is exclusive:
+//
+//	{"line": 1, "column": 4}
+//
+// Tokens hold the token as it is written in source ("(", "while", ...) or its
+// class ("identifier", "string", "number", "comment"), along with a value for
+// identifiers, strings, numbers and comments:
+//
+//	{"token": "identifier", "value": "x", "pos": position, "end": position}
+const JSONVersion = 1
+
+var nodeKinds = map[string]Node{
+	"Conditional":       ConditionalNode{},
+	"While":             WhileNode{},
+	"DoWhile":           DoWhileNode{},
+	"For":               ForNode{},
+	"ForIn":             ForInNode{},
+	"Break":             BreakNode{},
+	"Continue":          ContinueNode{},
+	"Labeled":           LabeledNode{},
+	"Block":             BlockNode{},
+	"Assignment":        AssignmentNode{},
+	"Destructure":       DestructureNode{},
+	"IdentifierPattern": IdentifierPatternNode{},
+	"ArrayPattern":      ArrayPatternNode{},
+	"MapPattern":        MapPatternNode{},
+	"TuplePattern":      TuplePatternNode{},
+	"LiteralPattern":    LiteralPatternNode{},
+	"WildcardPattern":   WildcardPatternNode{},
+	"ClassPattern":      ClassPatternNode{},
+	"Match":             MatchNode{},
+	"MatchArm":          MatchArmNode{},
+	"Set":               SetNode{},
+	"Call":              CallNode{},
+	"Arg":               ArgNode{},
+	"Func":              FuncNode{},
+	"Param":             ParamNode{},
+	"Return":            ReturnNode{},
+	"Throw":             ThrowNode{},
+	"Try":               TryNode{},
+	"Catch":             CatchNode{},
+	"Let":               LetNode{},
+	"Const":             ConstNode{},
+	"Class":             ClassNode{},
+	"LogicalExpr":       LogicalExprNode{},
+	"BinaryExpr":        BinaryExprNode{},
+	"UnaryExpr":         UnaryExprNode{},
+	"Lookup":            LookupNode{},
+	"This":              ThisNode{},
+	"Super":             SuperNode{},
+	"Literal":           LiteralNode{},
+	"Group":             GroupNode{},
+}
+
+// jsonField describes a field of a node of this package. Node and token
+// fields must not be null unless they are optional, and a token field with
+// tokens can only hold one of them. Arrays may always be null.
+type jsonField struct {
+	optional bool
+	tokens   []tokenize.TokenID
+}
+
+func required(tokens ...tokenize.TokenID) jsonField {
+	return jsonField{tokens: tokens}
+}
+
+func optional(tokens ...tokenize.TokenID) jsonField {
+	return jsonField{optional: true, tokens: tokens}
+}
+
+var (
+	assignmentTokenIDs = []tokenize.TokenID{
+		tokenize.TokenEqual,
+		tokenize.TokenPlusEqual,
+		tokenize.TokenMinusEqual,
+		tokenize.TokenStarEqual,
+		tokenize.TokenSlashEqual,
+	}
+	binaryTokenIDs = append(append(append(append(append(append([]tokenize.TokenID{},
+		factorOperatorTokenIDs...), termOperatorTokenIDs...),
+		comparisonOperatorTokenIDs...), equalityOperatorTokenIDs...),
+		conjunctionOperatorTokenIDs...), disjunctionOperatorTokenIDs...)
+	identifier = required(tokenize.TokenIdentifier)
+)
+
+// jsonFields holds the fields of each node kind that are optional or can only
+// hold certain tokens. The rest are required and can hold any token, such as
+// the closing tokens that only end a node's span.
+var jsonFields = map[string]map[string]jsonField{
+	"Conditional": {
+		"If":        required(tokenize.TokenIf),
+		"Else":      optional(tokenize.TokenElse),
+		"FalseBody": optional(),
+	},
+	"While": {"While": required(tokenize.TokenWhile)},
+	"DoWhile": {
+		"Do":    required(tokenize.TokenDo),
+		"While": required(tokenize.TokenWhile),
+	},
+	"For": {
+		"For":       required(tokenize.TokenFor),
+		"Init":      optional(),
+		"Condition": optional(),
+		"Update":    optional(),
+	},
+	"ForIn": {
+		"For":   required(tokenize.TokenFor),
+		"Key":   optional(tokenize.TokenIdentifier),
+		"Value": identifier,
+		"In":    required(tokenize.TokenIn),
+	},
+	"Break":             {"Break": required(tokenize.TokenBreak), "Label": optional(tokenize.TokenIdentifier)},
+	"Continue":          {"Continue": required(tokenize.TokenContinue), "Label": optional(tokenize.TokenIdentifier)},
+	"Labeled":           {"Label": identifier, "Colon": optional(tokenize.TokenColon)},
+	"Assignment":        {"LHS": identifier, "Equal": required(assignmentTokenIDs...)},
+	"Destructure":       {"Equal": required(tokenize.TokenEqual)},
+	"IdentifierPattern": {"Name": identifier},
+	"ArrayPattern": {
+		"LeftBracket": required(tokenize.TokenLeftBracket),
+	},
+	"MapPattern": {
+		"LeftCurly":  optional(tokenize.TokenLeftCurly),
+		"Keys":       identifier,
+		"RightCurly": optional(),
+	},
+	"LiteralPattern": {
+		"Minus": optional(tokenize.TokenMinus),
+		"Value": required(literalPatternTokenIDs...),
+	},
+	"WildcardPattern": {"Underscore": identifier},
+	"ClassPattern":    {"Class": identifier},
+	"Match": {
+		"Match":     required(tokenize.TokenMatch),
+		"LeftCurly": required(tokenize.TokenLeftCurly),
+	},
+	"MatchArm": {
+		"If":    optional(tokenize.TokenIf),
+		"Guard": optional(),
+		"Arrow": required(tokenize.TokenArrow),
+	},
+	"Set": {"Key": identifier, "Equal": required(assignmentTokenIDs...)},
+	"Call": {
+		"LeftParen": required(tokenize.TokenLeftParen),
+	},
+	"Arg": {
+		"Name":  optional(tokenize.TokenIdentifier),
+		"Colon": optional(tokenize.TokenColon),
+	},
+	"Func": {
+		"Func":      required(tokenize.TokenFunc),
+		"Name":      optional(tokenize.TokenIdentifier),
+		"LeftParen": required(tokenize.TokenLeftParen),
+	},
+	"Param": {
+		"Ellipsis": optional(tokenize.TokenEllipsis),
+		"Name":     identifier,
+		"Equal":    optional(tokenize.TokenEqual),
+		"Default":  optional(),
+	},
+	"Return": {"Return": required(tokenize.TokenReturn), "Value": optional()},
+	"Throw":  {"Throw": required(tokenize.TokenThrow)},
+	"Try": {
+		"Try":         required(tokenize.TokenTry),
+		"Finally":     optional(tokenize.TokenFinally),
+		"FinallyBody": optional(),
+	},
+	"Catch": {
+		"Catch": required(tokenize.TokenCatch),
+		"Name":  identifier,
+		"Colon": optional(tokenize.TokenColon),
+		"Class": optional(tokenize.TokenIdentifier),
+	},
+	"Let": {
+		"Let":   required(tokenize.TokenLet),
+		"Name":  identifier,
+		"Equal": optional(tokenize.TokenEqual),
+		"Value": optional(),
+	},
+	"Const": {
+		"Const": required(tokenize.TokenConst),
+		"Name":  identifier,
+		"Equal": required(tokenize.TokenEqual),
+	},
+	"Class": {
+		"Class":       required(tokenize.TokenClass),
+		"Name":        optional(tokenize.TokenIdentifier),
+		"Extends":     optional(tokenize.TokenLess),
+		"ParentClass": optional(tokenize.TokenIdentifier),
+		"BodyStart":   required(tokenize.TokenLeftCurly),
+	},
+	"LogicalExpr": {"Operator": required(tokenize.TokenAnd, tokenize.TokenOr)},
+	"BinaryExpr":  {"Operator": required(binaryTokenIDs...)},
+	"UnaryExpr":   {"Operator": required(unaryOperatorTokenIDs...)},
+	"Lookup":      {"Key": identifier},
+	"This":        {"This": required(tokenize.TokenThis)},
+	"Super":       {"Super": required(tokenize.TokenSuper), "Method": identifier},
+	"Literal":     {"Value": required(atomicTokenIDs...)},
+	"Group": {
+		"LeftParen": required(tokenize.TokenLeftParen),
+	},
+}
+
+var kindsByType = func() map[reflect.Type]string {
+	kinds := make(map[reflect.Type]string, len(nodeKinds))
+	for kind, node := range nodeKinds {
+		kinds[reflect.TypeOf(node)] = kind
+	}
+	return kinds
+}()
+
+// RegisterNode adds the type of node, a struct, to the JSON format under kind
+// and lets it be stored in an arena. Like the nodes of this package, its
+// fields must be nodes, tokens or slices of either. It must be called before
+// any nodes are encoded, decoded or compacted, such as from an init function.
+func RegisterNode(kind string, node ExtensionNode) {
+	typ := reflect.TypeOf(node)
+	if _, ok := nodeKinds[kind]; ok {
+		panic("RegisterNode: duplicate node kind " + kind)
+	}
+	nodeKinds[kind] = node
+	kindsByType[typ] = kind
+	arenaKindsByType[typ] = uint8(len(arenaKinds))
+	arenaKinds = append(arenaKinds, typ)
+	arenaLayouts = append(arenaLayouts, arenaLayout(typ))
+}
+
+var (
+	nodeType            = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenHolderType     = reflect.TypeOf((*tokenize.TokenHolder)(nil)).Elem()
+	tokenType           = reflect.TypeOf(tokenize.Token{})
+	identifierTokenType = reflect.TypeOf(tokenize.IdentifierToken{})
+	commentTokenType    = reflect.TypeOf(tokenize.CommentToken{})
+)
+
+type jsonDocument struct {
+	Version int               `json:"version"`
+	Nodes   []json.RawMessage `json:"nodes"`
+}
+
+type jsonPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type jsonToken struct {
+	Token string       `json:"token"`
+	Value interface{}  `json:"value,omitempty"`
+	Pos   jsonPosition `json:"pos"`
+	End   jsonPosition `json:"end"`
+}
+
+// MarshalJSON encodes a parsed program in the format described by JSONVersion.
+func MarshalJSON(nodes []Node) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`{"version":`)
+	writeJSON(&buf, JSONVersion)
+	buf.WriteString(`,"nodes":[`)
+	for i, node := range nodes {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := encodeValue(&buf, reflect.ValueOf(&node).Elem()); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteString("]}")
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a program written by MarshalJSON. A node with unknown
+// keys, a missing required field or a token that doesn't fit its field is
+// reported with a JSONSchemaError.
+func UnmarshalJSON(data []byte) ([]Node, error) {
+	var document jsonDocument
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	if document.Version != JSONVersion {
+		return nil, &JSONVersionError{version: document.Version}
+	}
+	nodes := make([]Node, 0, len(document.Nodes))
+	for i, raw := range document.Nodes {
+		path := "nodes[" + strconv.Itoa(i) + "]"
+		if isNull(raw) {
+			return nil, &JSONSchemaError{path: path, message: "expected a node"}
+		}
+		value, err := decodeValue(raw, nodeType, path)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, value.Interface().(Node))
+	}
+	return nodes, nil
+}
+
+func encodeValue(buf *bytes.Buffer, v reflect.Value) error {
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch {
+	case v.Type().Implements(tokenHolderType):
+		if v.IsZero() {
+			buf.WriteString("null")
+			return nil
+		}
+		writeJSON(buf, encodeToken(v.Interface().(tokenize.TokenHolder)))
+		return nil
+	case v.Kind() == reflect.Slice:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeValue(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	}
+	kind, ok := kindsByType[v.Type()]
+	if !ok {
+		return &JSONSchemaError{path: v.Type().String(), message: "unsupported type"}
+	}
+	node := v.Interface().(Node)
+	buf.WriteString(`{"kind":`)
+	writeJSON(buf, kind)
+	buf.WriteString(`,"pos":`)
+	writeJSON(buf, jsonPosition(node.Pos()))
+	buf.WriteString(`,"end":`)
+	writeJSON(buf, jsonPosition(node.End()))
+	for i := 0; i < v.NumField(); i++ {
+		buf.WriteByte(',')
+		writeJSON(buf, v.Type().Field(i).Name)
+		buf.WriteByte(':')
+		if err := encodeValue(buf, v.Field(i)); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func encodeToken(token tokenize.TokenHolder) jsonToken {
+	encoded := jsonToken{
+		Token: token.GetID().String(),
+		Pos:   jsonPosition(token.GetPos()),
+		End:   jsonPosition(token.GetEnd()),
+	}
+	switch token := token.(type) {
+	case tokenize.StringToken:
+		encoded.Value = token.GetValue()
+	case tokenize.NumberToken:
+		encoded.Value = token.GetValue()
+	case tokenize.IdentifierToken:
+		if token.GetID() == tokenize.TokenIdentifier {
+			encoded.Value = token.GetValue()
+		}
+	case tokenize.CommentToken:
+		encoded.Value = token.GetValue()
+	}
+	return encoded
+}
+
+func writeJSON(buf *bytes.Buffer, value interface{}) {
+	// Only positions, tokens, strings and numbers are written, which can
+	// always be encoded.
+	encoded, _ := json.Marshal(value)
+	buf.Write(encoded)
+}
+
+func isNull(raw json.RawMessage) bool {
+	return len(raw) == 0 || string(bytes.TrimSpace(raw)) == "null"
+}
+
+// decodeValue decodes raw into a value that can be assigned to typ, returning
+// the zero value of typ when raw is null.
+func decodeValue(raw json.RawMessage, typ reflect.Type, path string) (reflect.Value, error) {
+	if isNull(raw) {
+		return reflect.Zero(typ), nil
+	}
+	switch {
+	case typ == tokenHolderType || typ == tokenType || typ == identifierTokenType || typ == commentTokenType:
+		token, err := decodeToken(raw, path, typ != tokenType)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		switch typ {
+		case tokenType:
+			return reflect.ValueOf(token.GetToken()), nil
+		case identifierTokenType:
+			identifier, ok := token.(tokenize.IdentifierToken)
+			if !ok {
+				return reflect.Value{}, &JSONSchemaError{path: path, message: "expected an identifier or keyword token"}
+			}
+			return reflect.ValueOf(identifier), nil
+		case commentTokenType:
+			comment, ok := token.(tokenize.CommentToken)
+			if !ok {
+				return reflect.Value{}, &JSONSchemaError{path: path, message: "expected a comment token"}
+			}
+			return reflect.ValueOf(comment), nil
+		}
+		return reflect.ValueOf(token), nil
+	case typ.Kind() == reflect.Slice:
+		var elements []json.RawMessage
+		if err := json.Unmarshal(raw, &elements); err != nil {
+			return reflect.Value{}, &JSONSchemaError{path: path, message: "expected an array"}
+		}
+		slice := reflect.MakeSlice(typ, len(elements), len(elements))
+		for i, element := range elements {
+			value, err := decodeValue(element, typ.Elem(), path+"["+strconv.Itoa(i)+"]")
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			slice.Index(i).Set(value)
+		}
+		return slice, nil
+	case typ.Implements(nodeType):
+		return decodeNode(raw, typ, path)
+	}
+	return reflect.Value{}, &JSONSchemaError{path: path, message: "unsupported type " + typ.String()}
+}
+
+func decodeNode(raw json.RawMessage, typ reflect.Type, path string) (reflect.Value, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return reflect.Value{}, &JSONSchemaError{path: path, message: "expected a node"}
+	}
+	var kind string
+	if err := json.Unmarshal(fields["kind"], &kind); err != nil {
+		return reflect.Value{}, &JSONSchemaError{path: path, message: "expected a node kind"}
+	}
+	prototype, ok := nodeKinds[kind]
+	if !ok {
+		return reflect.Value{}, &JSONSchemaError{path: path, message: "unknown node kind \"" + kind + "\""}
+	}
+	nodeType := reflect.TypeOf(prototype)
+	if !nodeType.AssignableTo(typ) {
+		return reflect.Value{}, &JSONSchemaError{path: path, message: "expected " + typ.Name() + ", got \"" + kind + "\""}
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := nodeType.FieldByName(key); !ok && key != "kind" && key != "pos" && key != "end" {
+			return reflect.Value{}, &JSONSchemaError{path: path, message: "unknown field \"" + key + "\""}
+		}
+	}
+	// The fields of registered nodes are all optional.
+	_, isExtension := prototype.(ExtensionNode)
+	node := reflect.New(nodeType).Elem()
+	for i := 0; i < nodeType.NumField(); i++ {
+		field := nodeType.Field(i)
+		fieldPath := path + "." + field.Name
+		schema := jsonFields[kind][field.Name]
+		raw := fields[field.Name]
+		if isNull(raw) && !isExtension && !schema.optional && field.Type.Kind() != reflect.Slice {
+			return reflect.Value{}, &JSONSchemaError{path: fieldPath, message: "missing required field"}
+		}
+		value, err := decodeValue(raw, field.Type, fieldPath)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if err := checkTokens(value, schema.tokens, fieldPath); err != nil {
+			return reflect.Value{}, err
+		}
+		node.Field(i).Set(value)
+	}
+	return node, nil
+}
+
+// checkTokens checks that a token, or each token in a slice, is one of ids
+// unless there are none.
+func checkTokens(value reflect.Value, ids []tokenize.TokenID, path string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if value.Kind() == reflect.Slice {
+		for i := 0; i < value.Len(); i++ {
+			if err := checkTokens(value.Index(i), ids, path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.IsZero() {
+		return nil
+	}
+	id := value.Interface().(tokenize.TokenHolder).GetID()
+	for _, expected := range ids {
+		if id == expected {
+			return nil
+		}
+	}
+	return &JSONSchemaError{path: path, message: "unexpected token \"" + id.String() + "\""}
+}
+
+// decodeToken decodes a token, which must have a value unless hasValue is
+// false. Fields of type tokenize.Token only keep the ID and span of a token, so
+// they can hold a copy of a token without its value.
+func decodeToken(raw json.RawMessage, path string, hasValue bool) (tokenize.TokenHolder, error) {
+	var token jsonToken
+	if err := json.Unmarshal(raw, &token); err != nil {
+		return nil, &JSONSchemaError{path: path, message: "expected a token"}
+	}
+	id, ok := tokenize.LookupTokenID(token.Token)
+	if !ok {
+		return nil, &JSONSchemaError{path: path, message: "unknown token \"" + token.Token + "\""}
+	}
+	var text string
+	var number float64
+	switch {
+	case !hasValue:
+	case id == tokenize.TokenString:
+		value, ok := token.Value.(string)
+		if !ok {
+			return nil, &JSONSchemaError{path: path, message: "expected a string value"}
+		}
+		text = value
+	case id == tokenize.TokenNumber:
+		value, ok := token.Value.(float64)
+		if !ok {
+			return nil, &JSONSchemaError{path: path, message: "expected a number value"}
+		}
+		number = value
+	case id == tokenize.TokenIdentifier:
+		value, ok := token.Value.(string)
+		if !ok || value == "" {
+			return nil, &JSONSchemaError{path: path, message: "expected an identifier value"}
+		}
+		text = value
+	case id == tokenize.TokenComment:
+		value, ok := token.Value.(string)
+		if !ok {
+			return nil, &JSONSchemaError{path: path, message: "expected a comment value"}
+		}
+		text = value
+	}
+	return newToken(id, text, number, tokenize.Position(token.Pos), tokenize.Position(token.End)), nil
+}
+
+// newToken builds a token of the type the tokenizer would have produced for
+// id, using text as the value of identifiers, strings and comments and number
+// as the value of numbers.
+func newToken(id tokenize.TokenID, text string, number float64, pos, end tokenize.Position) tokenize.TokenHolder {
+	switch {
+	case id == tokenize.TokenString:
+		return tokenize.NewStringToken(text, pos, end)
+	case id == tokenize.TokenNumber:
+		return tokenize.NewNumberToken(number, pos, end)
+	case id == tokenize.TokenIdentifier || tokenize.IsKeyword(id):
+		return tokenize.NewIdentifierToken(id, text, pos, end)
+	case id == tokenize.TokenComment:
+		return tokenize.NewCommentToken(text, pos, end)
+	}
+	return tokenize.NewToken(id, pos, end)
+}
@@ -10,6 +10,8 @@ import (
 type Node interface {
 	GetStartToken() tokenize.TokenHolder
 	GetEndToken() tokenize.TokenHolder
+	Pos() tokenize.Position
+	End() tokenize.Position
 	String() string
 }
 
@@ -21,11 +23,26 @@ type ExpressionNode interface {
 	Node
 }
 
+type PatternNode interface {
+	Node
+}
+
 type AtomNode interface {
 	ExpressionNode
 	GetToken() tokenize.TokenHolder
 }
 
+// ExtensionNode is a node defined outside of this package, such as the core
+// forms of a lowered program. Apply and Inspect reach its children through
+// ApplyChildren, and RegisterNode adds it to the JSON format and arenas.
+type ExtensionNode interface {
+	Node
+	// ApplyChildren calls apply with each child of the node in order, along
+	// with the name of the field holding it, and returns a copy of the node
+	// with each child replaced by the result.
+	ApplyChildren(apply func(name string, child Node) Node) Node
+}
+
 type ConditionalNode struct {
 	If        tokenize.IdentifierToken
 	Condition ExpressionNode
@@ -40,6 +57,14 @@ type WhileNode struct {
 	Body      StatementNode
 }
 
+type DoWhileNode struct {
+	Do         tokenize.IdentifierToken
+	Body       StatementNode
+	While      tokenize.IdentifierToken
+	Condition  ExpressionNode
+	RightParen tokenize.TokenHolder
+}
+
 type ForNode struct {
 	For       tokenize.IdentifierToken
 	Init      ExpressionNode
@@ -48,6 +73,37 @@ type ForNode struct {
 	Body      StatementNode
 }
 
+type BreakNode struct {
+	Break tokenize.IdentifierToken
+	Label tokenize.IdentifierToken
+}
+
+type ContinueNode struct {
+	Continue tokenize.IdentifierToken
+	Label    tokenize.IdentifierToken
+}
+
+type LabeledNode struct {
+	Label tokenize.IdentifierToken
+	Colon tokenize.TokenHolder
+	Body  StatementNode
+}
+
+// ForInNode loops over a collection with the iteration protocol. Before the
+// first iteration, iter() is called on the collection to get an iterator. Then
+// next() is called on the iterator before every iteration, returning an entry
+// whose done field is true once the iterator is exhausted. Otherwise, the
+// entry's value field, and its key field for the two variable form, are bound
+// to the loop variables.
+type ForInNode struct {
+	For        tokenize.IdentifierToken
+	Key        tokenize.IdentifierToken
+	Value      tokenize.IdentifierToken
+	In         tokenize.IdentifierToken
+	Collection ExpressionNode
+	Body       StatementNode
+}
+
 type BlockNode struct {
 	BodyStart tokenize.Token
 	Children  []StatementNode
@@ -58,21 +114,107 @@ type AssignmentNode struct {
 	LHS   tokenize.TokenHolder
 	Equal tokenize.TokenHolder
 	RHS   ExpressionNode
+	// Doc holds the doc comments right before a declaration, which are
+	// attached by AttachDocs.
+	Doc []tokenize.CommentToken
+}
+
+// DestructureNode assigns the values on the right hand side to the variables
+// bound by Pattern. A single value is unpacked to fit the pattern, so a
+// function can return several values as an array to be destructured by a
+// TuplePatternNode or ArrayPatternNode.
+type DestructureNode struct {
+	Pattern PatternNode
+	Equal   tokenize.TokenHolder
+	Values  []ExpressionNode
+}
+
+type IdentifierPatternNode struct {
+	Name tokenize.IdentifierToken
+}
+
+type ArrayPatternNode struct {
+	LeftBracket  tokenize.TokenHolder
+	Elements     []PatternNode
+	RightBracket tokenize.TokenHolder
+}
+
+type MapPatternNode struct {
+	LeftCurly  tokenize.TokenHolder
+	Keys       []tokenize.IdentifierToken
+	RightCurly tokenize.TokenHolder
+}
+
+type TuplePatternNode struct {
+	Elements []PatternNode
+}
+
+type LiteralPatternNode struct {
+	// Minus is the sign of a negative number, or nil.
+	Minus tokenize.TokenHolder
+	Value tokenize.TokenHolder
+}
+
+type WildcardPatternNode struct {
+	Underscore tokenize.IdentifierToken
+}
+
+type ClassPatternNode struct {
+	Class  tokenize.IdentifierToken
+	Fields MapPatternNode
+}
+
+type MatchNode struct {
+	Match      tokenize.IdentifierToken
+	Value      ExpressionNode
+	LeftCurly  tokenize.TokenHolder
+	Arms       []MatchArmNode
+	RightCurly tokenize.TokenHolder
+}
+
+type MatchArmNode struct {
+	Pattern PatternNode
+	If      tokenize.TokenHolder
+	Guard   ExpressionNode
+	Arrow   tokenize.TokenHolder
+	Body    ExpressionNode
+}
+
+type SetNode struct {
+	Object ExpressionNode
+	Key    tokenize.IdentifierToken
+	Equal  tokenize.TokenHolder
+	RHS    ExpressionNode
 }
 
 type CallNode struct {
 	Function   ExpressionNode
 	LeftParen  tokenize.TokenHolder
-	Args       []ExpressionNode
+	Args       []ArgNode
 	RightParen tokenize.TokenHolder
 }
 
+type ArgNode struct {
+	Name  tokenize.IdentifierToken
+	Colon tokenize.TokenHolder
+	Value ExpressionNode
+}
+
 type FuncNode struct {
 	Func       tokenize.TokenHolder
+	Name       tokenize.IdentifierToken
 	LeftParen  tokenize.TokenHolder
-	Params     []tokenize.IdentifierToken
+	Params     []ParamNode
 	RightParen tokenize.TokenHolder
 	Body       BlockNode
+	Doc        []tokenize.CommentToken
+}
+
+type ParamNode struct {
+	Ellipsis tokenize.TokenHolder
+	Name     tokenize.IdentifierToken
+	Equal    tokenize.TokenHolder
+	Default  ExpressionNode
 }
 
 type ReturnNode struct {
@@ -80,13 +222,56 @@ type ReturnNode struct {
 	Value  ExpressionNode
 }
 
+type ThrowNode struct {
+	Throw tokenize.IdentifierToken
+	Value ExpressionNode
+}
+
+// TryNode runs its body, handing any thrown value to the first catch whose
+// class matches it. When there is a finally body, it runs on every exit path
+// out of the try and catch bodies, including return, break and continue, as
+// well as values thrown out of the try statement.
+type TryNode struct {
+	Try         tokenize.IdentifierToken
+	Body        BlockNode
+	Catches     []CatchNode
+	Finally     tokenize.IdentifierToken
+	FinallyBody StatementNode
+}
+
+type CatchNode struct {
+	Catch tokenize.IdentifierToken
+	Name  tokenize.IdentifierToken
+	Colon tokenize.TokenHolder
+	Class tokenize.IdentifierToken
+	Body  BlockNode
+}
+
+type LetNode struct {
+	Let   tokenize.IdentifierToken
+	Name  tokenize.IdentifierToken
+	Equal tokenize.TokenHolder
+	Value ExpressionNode
+	Doc   []tokenize.CommentToken
+}
+
+type ConstNode struct {
+	Const tokenize.IdentifierToken
+	Name  tokenize.IdentifierToken
+	Equal tokenize.TokenHolder
+	Value ExpressionNode
+	Doc   []tokenize.CommentToken
+}
+
 type ClassNode struct {
 	Class       tokenize.IdentifierToken
+	Name        tokenize.IdentifierToken
 	Extends     tokenize.TokenHolder
 	ParentClass tokenize.IdentifierToken
 	BodyStart   tokenize.TokenHolder
 	Body        []AssignmentNode
 	BodyEnd     tokenize.TokenHolder
+	Doc         []tokenize.CommentToken
 }
 
 type LogicalExprNode struct {
@@ -111,10 +296,27 @@ type LookupNode struct {
 	Key   tokenize.IdentifierToken
 }
 
+type ThisNode struct {
+	This tokenize.IdentifierToken
+}
+
+type SuperNode struct {
+	Super  tokenize.IdentifierToken
+	Method tokenize.IdentifierToken
+}
+
 type LiteralNode struct {
 	Value tokenize.TokenHolder
 }
 
+// GroupNode is an expression in parentheses. It prints as the expression
+// inside of it, since the nesting is already explicit.
+type GroupNode struct {
+	LeftParen  tokenize.TokenHolder
+	Expression ExpressionNode
+	RightParen tokenize.TokenHolder
+}
+
 func (n ConditionalNode) GetStartToken() tokenize.TokenHolder {
 	return n.If
 }
@@ -124,6 +326,12 @@ func (n ConditionalNode) GetEndToken() tokenize.TokenHolder {
 	}
 	return n.TrueBody.GetEndToken()
 }
+func (n ConditionalNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n ConditionalNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
 func (n ConditionalNode) String() string {
 	if n.FalseBody == nil {
 		return fmt.Sprintf("(if %s %s)", n.Condition, n.TrueBody)
@@ -137,18 +345,131 @@ func (n WhileNode) GetStartToken() tokenize.TokenHolder {
 func (n WhileNode) GetEndToken() tokenize.TokenHolder {
 	return n.Body.GetEndToken()
 }
+func (n WhileNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n WhileNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
 func (n WhileNode) String() string {
 	return fmt.Sprintf("(while %s %s)", n.Condition, n.Body)
 }
 
+func (n DoWhileNode) GetStartToken() tokenize.TokenHolder {
+	return n.Do
+}
+func (n DoWhileNode) GetEndToken() tokenize.TokenHolder {
+	return n.RightParen
+}
+func (n DoWhileNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n DoWhileNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n DoWhileNode) String() string {
+	return fmt.Sprintf("(do %s while %s)", n.Body, n.Condition)
+}
+
 func (n ForNode) GetStartToken() tokenize.TokenHolder {
 	return n.For
 }
 func (n ForNode) GetEndToken() tokenize.TokenHolder {
 	return n.Body.GetEndToken()
 }
+func (n ForNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n ForNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
 func (n ForNode) String() string {
-	return fmt.Sprintf("(for %s %s %s %s)", n.Init, n.Condition, n.Update, n.Body)
+	return fmt.Sprintf(
+		"(for %s %s %s %s)",
+		optionalString(n.Init),
+		optionalString(n.Condition),
+		optionalString(n.Update),
+		n.Body,
+	)
+}
+
+func (n ForInNode) GetStartToken() tokenize.TokenHolder {
+	return n.For
+}
+func (n ForInNode) GetEndToken() tokenize.TokenHolder {
+	return n.Body.GetEndToken()
+}
+func (n ForInNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n ForInNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n ForInNode) String() string {
+	if key := n.Key.GetValue(); len(key) > 0 {
+		return fmt.Sprintf("(for-in %s %s %s %s)", key, n.Value.GetValue(), n.Collection, n.Body)
+	}
+	return fmt.Sprintf("(for-in %s %s %s)", n.Value.GetValue(), n.Collection, n.Body)
+}
+
+func (n BreakNode) GetStartToken() tokenize.TokenHolder {
+	return n.Break
+}
+func (n BreakNode) GetEndToken() tokenize.TokenHolder {
+	if len(n.Label.GetValue()) > 0 {
+		return n.Label
+	}
+	return n.Break
+}
+func (n BreakNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n BreakNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n BreakNode) String() string {
+	if label := n.Label.GetValue(); len(label) > 0 {
+		return fmt.Sprintf("(break %s)", label)
+	}
+	return "(break)"
+}
+
+func (n ContinueNode) GetStartToken() tokenize.TokenHolder {
+	return n.Continue
+}
+func (n ContinueNode) GetEndToken() tokenize.TokenHolder {
+	if len(n.Label.GetValue()) > 0 {
+		return n.Label
+	}
+	return n.Continue
+}
+func (n ContinueNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n ContinueNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n ContinueNode) String() string {
+	if label := n.Label.GetValue(); len(label) > 0 {
+		return fmt.Sprintf("(continue %s)", label)
+	}
+	return "(continue)"
+}
+
+func (n LabeledNode) GetStartToken() tokenize.TokenHolder {
+	return n.Label
+}
+func (n LabeledNode) GetEndToken() tokenize.TokenHolder {
+	return n.Body.GetEndToken()
+}
+func (n LabeledNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n LabeledNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n LabeledNode) String() string {
+	return fmt.Sprintf("(label %s %s)", n.Label.GetValue(), n.Body)
 }
 
 func (n BlockNode) GetStartToken() tokenize.TokenHolder {
@@ -157,6 +478,12 @@ func (n BlockNode) GetStartToken() tokenize.TokenHolder {
 func (n BlockNode) GetEndToken() tokenize.TokenHolder {
 	return n.BodyEnd
 }
+func (n BlockNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n BlockNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
 func (n BlockNode) String() string {
 	return fmt.Sprintf("(block %s)", n.Children)
 }
@@ -167,16 +494,227 @@ func (n AssignmentNode) GetStartToken() tokenize.TokenHolder {
 func (n AssignmentNode) GetEndToken() tokenize.TokenHolder {
 	return n.RHS.GetEndToken()
 }
+func (n AssignmentNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n AssignmentNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
 func (n AssignmentNode) String() string {
+	if isCompoundOperator(n.Equal) {
+		return fmt.Sprintf("(%s %s %s)", n.Equal.GetID(), n.LHS, n.RHS)
+	}
 	return fmt.Sprintf("(= %s %s)", n.LHS, n.RHS)
 }
 
+func (n DestructureNode) GetStartToken() tokenize.TokenHolder {
+	return n.Pattern.GetStartToken()
+}
+func (n DestructureNode) GetEndToken() tokenize.TokenHolder {
+	return n.Values[len(n.Values)-1].GetEndToken()
+}
+func (n DestructureNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n DestructureNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n DestructureNode) String() string {
+	var values strings.Builder
+	for _, value := range n.Values {
+		values.WriteString(fmt.Sprintf(" %s", value))
+	}
+	return fmt.Sprintf("(destructure %s%s)", n.Pattern, values.String())
+}
+
+func (n IdentifierPatternNode) GetStartToken() tokenize.TokenHolder {
+	return n.Name
+}
+func (n IdentifierPatternNode) GetEndToken() tokenize.TokenHolder {
+	return n.Name
+}
+func (n IdentifierPatternNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n IdentifierPatternNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n IdentifierPatternNode) String() string {
+	return n.Name.GetValue()
+}
+
+func (n ArrayPatternNode) GetStartToken() tokenize.TokenHolder {
+	return n.LeftBracket
+}
+func (n ArrayPatternNode) GetEndToken() tokenize.TokenHolder {
+	return n.RightBracket
+}
+func (n ArrayPatternNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n ArrayPatternNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n ArrayPatternNode) String() string {
+	return fmt.Sprintf("(array%s)", patternsString(n.Elements))
+}
+
+func (n MapPatternNode) GetStartToken() tokenize.TokenHolder {
+	return n.LeftCurly
+}
+func (n MapPatternNode) GetEndToken() tokenize.TokenHolder {
+	return n.RightCurly
+}
+func (n MapPatternNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n MapPatternNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n MapPatternNode) String() string {
+	var keys strings.Builder
+	for _, key := range n.Keys {
+		keys.WriteString(fmt.Sprintf(" %s", key.GetValue()))
+	}
+	return fmt.Sprintf("(map%s)", keys.String())
+}
+
+func (n TuplePatternNode) GetStartToken() tokenize.TokenHolder {
+	return n.Elements[0].GetStartToken()
+}
+func (n TuplePatternNode) GetEndToken() tokenize.TokenHolder {
+	return n.Elements[len(n.Elements)-1].GetEndToken()
+}
+func (n TuplePatternNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n TuplePatternNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n TuplePatternNode) String() string {
+	return fmt.Sprintf("(tuple%s)", patternsString(n.Elements))
+}
+
+func (n LiteralPatternNode) GetStartToken() tokenize.TokenHolder {
+	if n.Minus != nil {
+		return n.Minus
+	}
+	return n.Value
+}
+func (n LiteralPatternNode) GetEndToken() tokenize.TokenHolder {
+	return n.Value
+}
+func (n LiteralPatternNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n LiteralPatternNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n LiteralPatternNode) String() string {
+	if n.Minus != nil {
+		return fmt.Sprintf("(%s -%s)", n.Value.GetID(), n.Value)
+	}
+	return fmt.Sprintf("(%s %s)", n.Value.GetID(), n.Value)
+}
+
+func (n WildcardPatternNode) GetStartToken() tokenize.TokenHolder {
+	return n.Underscore
+}
+func (n WildcardPatternNode) GetEndToken() tokenize.TokenHolder {
+	return n.Underscore
+}
+func (n WildcardPatternNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n WildcardPatternNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n WildcardPatternNode) String() string {
+	return "_"
+}
+
+func (n ClassPatternNode) GetStartToken() tokenize.TokenHolder {
+	return n.Class
+}
+func (n ClassPatternNode) GetEndToken() tokenize.TokenHolder {
+	return n.Fields.GetEndToken()
+}
+func (n ClassPatternNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n ClassPatternNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n ClassPatternNode) String() string {
+	return fmt.Sprintf("(instance %s %s)", n.Class.GetValue(), n.Fields)
+}
+
+func (n MatchNode) GetStartToken() tokenize.TokenHolder {
+	return n.Match
+}
+func (n MatchNode) GetEndToken() tokenize.TokenHolder {
+	return n.RightCurly
+}
+func (n MatchNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n MatchNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n MatchNode) String() string {
+	return fmt.Sprintf("(match %s %s)", n.Value, n.Arms)
+}
+
+func (n MatchArmNode) GetStartToken() tokenize.TokenHolder {
+	return n.Pattern.GetStartToken()
+}
+func (n MatchArmNode) GetEndToken() tokenize.TokenHolder {
+	return n.Body.GetEndToken()
+}
+func (n MatchArmNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n MatchArmNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n MatchArmNode) String() string {
+	if n.Guard != nil {
+		return fmt.Sprintf("(=> %s if %s %s)", n.Pattern, n.Guard, n.Body)
+	}
+	return fmt.Sprintf("(=> %s %s)", n.Pattern, n.Body)
+}
+
+func (n SetNode) GetStartToken() tokenize.TokenHolder {
+	return n.Object.GetStartToken()
+}
+func (n SetNode) GetEndToken() tokenize.TokenHolder {
+	return n.RHS.GetEndToken()
+}
+func (n SetNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n SetNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n SetNode) String() string {
+	if isCompoundOperator(n.Equal) {
+		return fmt.Sprintf("(set %s %s %s %s)", n.Object, n.Key.GetValue(), n.Equal.GetID(), n.RHS)
+	}
+	return fmt.Sprintf("(set %s %s %s)", n.Object, n.Key.GetValue(), n.RHS)
+}
+
 func (n CallNode) GetStartToken() tokenize.TokenHolder {
 	return n.Function.GetStartToken()
 }
 func (n CallNode) GetEndToken() tokenize.TokenHolder {
 	return n.RightParen
 }
+func (n CallNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n CallNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
 func (n CallNode) String() string {
 	var args strings.Builder
 	for _, child := range n.Args {
@@ -185,26 +723,94 @@ func (n CallNode) String() string {
 	return fmt.Sprintf("(call %s%s)", n.Function, args.String())
 }
 
+func (n ArgNode) GetStartToken() tokenize.TokenHolder {
+	if n.Colon != nil {
+		return n.Name
+	}
+	return n.Value.GetStartToken()
+}
+func (n ArgNode) GetEndToken() tokenize.TokenHolder {
+	return n.Value.GetEndToken()
+}
+func (n ArgNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n ArgNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n ArgNode) String() string {
+	if n.Colon != nil {
+		return fmt.Sprintf("(%s: %s)", n.Name.GetValue(), n.Value)
+	}
+	return n.Value.String()
+}
+
 func (n FuncNode) GetStartToken() tokenize.TokenHolder {
 	return n.Func
 }
 func (n FuncNode) GetEndToken() tokenize.TokenHolder {
-	return n.RightParen
+	return n.Body.GetEndToken()
+}
+func (n FuncNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n FuncNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
 }
 func (n FuncNode) String() string {
 	var params strings.Builder
 	for _, child := range n.Params {
-		params.WriteString(fmt.Sprintf(" %s", child.GetValue()))
+		params.WriteString(fmt.Sprintf(" %s", child))
+	}
+	if name := n.Name.GetValue(); len(name) > 0 {
+		return fmt.Sprintf("(func %s:%s %s)", name, params.String(), n.Body)
 	}
 	return fmt.Sprintf("(func%s %s)", params.String(), n.Body)
 }
 
+func (n ParamNode) GetStartToken() tokenize.TokenHolder {
+	if n.Ellipsis != nil {
+		return n.Ellipsis
+	}
+	return n.Name
+}
+func (n ParamNode) GetEndToken() tokenize.TokenHolder {
+	if n.Default != nil {
+		return n.Default.GetEndToken()
+	}
+	return n.Name
+}
+func (n ParamNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n ParamNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n ParamNode) String() string {
+	if n.Ellipsis != nil {
+		return fmt.Sprintf("...%s", n.Name.GetValue())
+	}
+	if n.Default != nil {
+		return fmt.Sprintf("(%s = %s)", n.Name.GetValue(), n.Default)
+	}
+	return n.Name.GetValue()
+}
+
 func (n ReturnNode) GetStartToken() tokenize.TokenHolder {
 	return n.Return
 }
 func (n ReturnNode) GetEndToken() tokenize.TokenHolder {
+	if n.Value == nil {
+		return n.Return
+	}
 	return n.Value.GetEndToken()
 }
+func (n ReturnNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n ReturnNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
 func (n ReturnNode) String() string {
 	value := n.Value
 	if value == nil {
@@ -213,18 +819,126 @@ func (n ReturnNode) String() string {
 	return fmt.Sprintf("(return %s)", value)
 }
 
+func (n ThrowNode) GetStartToken() tokenize.TokenHolder {
+	return n.Throw
+}
+func (n ThrowNode) GetEndToken() tokenize.TokenHolder {
+	return n.Value.GetEndToken()
+}
+func (n ThrowNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n ThrowNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n ThrowNode) String() string {
+	return fmt.Sprintf("(throw %s)", n.Value)
+}
+
+func (n TryNode) GetStartToken() tokenize.TokenHolder {
+	return n.Try
+}
+func (n TryNode) GetEndToken() tokenize.TokenHolder {
+	if n.FinallyBody != nil {
+		return n.FinallyBody.GetEndToken()
+	}
+	return n.Catches[len(n.Catches)-1].GetEndToken()
+}
+func (n TryNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n TryNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n TryNode) String() string {
+	str := fmt.Sprintf("(try %s", n.Body)
+	for _, catch := range n.Catches {
+		str += " " + catch.String()
+	}
+	if n.FinallyBody != nil {
+		str += fmt.Sprintf(" finally %s", n.FinallyBody)
+	}
+	return str + ")"
+}
+
+func (n CatchNode) GetStartToken() tokenize.TokenHolder {
+	return n.Catch
+}
+func (n CatchNode) GetEndToken() tokenize.TokenHolder {
+	return n.Body.GetEndToken()
+}
+func (n CatchNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n CatchNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n CatchNode) String() string {
+	if n.Colon != nil {
+		return fmt.Sprintf("(catch %s: %s %s)", n.Name.GetValue(), n.Class.GetValue(), n.Body)
+	}
+	return fmt.Sprintf("(catch %s %s)", n.Name.GetValue(), n.Body)
+}
+
+func (n LetNode) GetStartToken() tokenize.TokenHolder {
+	return n.Let
+}
+func (n LetNode) GetEndToken() tokenize.TokenHolder {
+	if n.Value == nil {
+		return n.Name
+	}
+	return n.Value.GetEndToken()
+}
+func (n LetNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n LetNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n LetNode) String() string {
+	if n.Value == nil {
+		return fmt.Sprintf("(let %s)", n.Name.GetValue())
+	}
+	return fmt.Sprintf("(let %s %s)", n.Name.GetValue(), n.Value)
+}
+
+func (n ConstNode) GetStartToken() tokenize.TokenHolder {
+	return n.Const
+}
+func (n ConstNode) GetEndToken() tokenize.TokenHolder {
+	return n.Value.GetEndToken()
+}
+func (n ConstNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n ConstNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n ConstNode) String() string {
+	return fmt.Sprintf("(const %s %s)", n.Name.GetValue(), n.Value)
+}
+
 func (n ClassNode) GetStartToken() tokenize.TokenHolder {
 	return n.Class
 }
 func (n ClassNode) GetEndToken() tokenize.TokenHolder {
 	return n.BodyEnd
 }
+func (n ClassNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n ClassNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
 func (n ClassNode) String() string {
-	parentName := n.ParentClass.GetValue()
-	if len(parentName) > 0 {
-		return fmt.Sprintf("(class %s %s)", parentName, n.Body)
+	var header strings.Builder
+	if name := n.Name.GetValue(); len(name) > 0 {
+		header.WriteString(fmt.Sprintf(" %s:", name))
+	}
+	if parentName := n.ParentClass.GetValue(); len(parentName) > 0 {
+		header.WriteString(fmt.Sprintf(" %s", parentName))
 	}
-	return fmt.Sprintf("(class %s)", n.Body)
+	return fmt.Sprintf("(class%s %s)", header.String(), n.Body)
 }
 
 func (n LogicalExprNode) GetStartToken() tokenize.TokenHolder {
@@ -233,6 +947,12 @@ func (n LogicalExprNode) GetStartToken() tokenize.TokenHolder {
 func (n LogicalExprNode) GetEndToken() tokenize.TokenHolder {
 	return n.RHS.GetEndToken()
 }
+func (n LogicalExprNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n LogicalExprNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
 func (n LogicalExprNode) String() string {
 	return fmt.Sprintf("(%s %s %s)", n.Operator.GetValue(), n.LHS, n.RHS)
 }
@@ -243,6 +963,12 @@ func (n BinaryExprNode) GetStartToken() tokenize.TokenHolder {
 func (n BinaryExprNode) GetEndToken() tokenize.TokenHolder {
 	return n.RHS.GetEndToken()
 }
+func (n BinaryExprNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n BinaryExprNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
 func (n BinaryExprNode) String() string {
 	return fmt.Sprintf("(%s %s %s)", n.Operator.GetToken(), n.LHS, n.RHS)
 }
@@ -253,26 +979,141 @@ func (n UnaryExprNode) GetStartToken() tokenize.TokenHolder {
 func (n UnaryExprNode) GetEndToken() tokenize.TokenHolder {
 	return n.Operand.GetEndToken()
 }
+func (n UnaryExprNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n UnaryExprNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
 func (n UnaryExprNode) String() string {
-	return fmt.Sprintf("(%d %s)", n.Operator.GetToken(), n.Operand)
+	return fmt.Sprintf("(%s %s)", n.Operator, n.Operand)
 }
 
 func (n LookupNode) GetStartToken() tokenize.TokenHolder {
 	return n.Value.GetStartToken()
 }
 func (n LookupNode) GetEndToken() tokenize.TokenHolder {
-	return n.Value.GetEndToken()
+	return n.Key
+}
+func (n LookupNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n LookupNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
 }
 func (n LookupNode) String() string {
 	return fmt.Sprintf("(lookup %s %s)", n.Value, n.Key.GetValue())
 }
 
+func (n ThisNode) GetStartToken() tokenize.TokenHolder {
+	return n.This
+}
+func (n ThisNode) GetEndToken() tokenize.TokenHolder {
+	return n.This
+}
+func (n ThisNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n ThisNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n ThisNode) String() string {
+	return "(this)"
+}
+
+func (n SuperNode) GetStartToken() tokenize.TokenHolder {
+	return n.Super
+}
+func (n SuperNode) GetEndToken() tokenize.TokenHolder {
+	return n.Method
+}
+func (n SuperNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n SuperNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n SuperNode) String() string {
+	return fmt.Sprintf("(super %s)", n.Method.GetValue())
+}
+
 func (n LiteralNode) GetStartToken() tokenize.TokenHolder {
 	return n.Value
 }
 func (n LiteralNode) GetEndToken() tokenize.TokenHolder {
 	return n.Value
 }
+func (n LiteralNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n LiteralNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
 func (n LiteralNode) String() string {
 	return fmt.Sprintf("(%s %s)", n.Value.GetID(), n.Value)
 }
+
+func (n GroupNode) GetStartToken() tokenize.TokenHolder {
+	return n.LeftParen
+}
+func (n GroupNode) GetEndToken() tokenize.TokenHolder {
+	return n.RightParen
+}
+func (n GroupNode) Pos() tokenize.Position {
+	return n.GetStartToken().GetPos()
+}
+func (n GroupNode) End() tokenize.Position {
+	return n.GetEndToken().GetEnd()
+}
+func (n GroupNode) String() string {
+	return n.Expression.String()
+}
+
+// Unparen returns the expression inside of any parentheses around node.
+func Unparen(node Node) Node {
+	for {
+		group, ok := node.(GroupNode)
+		if !ok {
+			return node
+		}
+		node = group.Expression
+	}
+}
+
+func optionalString(n Node) string {
+	if n == nil {
+		return "nil"
+	}
+	return n.String()
+}
+
+func patternsString(patterns []PatternNode) string {
+	var sb strings.Builder
+	for _, pattern := range patterns {
+		sb.WriteString(fmt.Sprintf(" %s", pattern))
+	}
+	return sb.String()
+}
+
+// PatternBindings returns the names of the variables that are assigned to
+// when a value is destructured by the pattern, in source order.
+func PatternBindings(pattern PatternNode) []tokenize.IdentifierToken {
+	var names []tokenize.IdentifierToken
+	switch pattern := pattern.(type) {
+	case IdentifierPatternNode:
+		names = append(names, pattern.Name)
+	case ArrayPatternNode:
+		for _, element := range pattern.Elements {
+			names = append(names, PatternBindings(element)...)
+		}
+	case MapPatternNode:
+		names = append(names, pattern.Keys...)
+	case ClassPatternNode:
+		names = append(names, pattern.Fields.Keys...)
+	case TuplePatternNode:
+		for _, element := range pattern.Elements {
+			names = append(names, PatternBindings(element)...)
+		}
+	}
+	return names
+}
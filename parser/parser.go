@@ -4,26 +4,66 @@ import (
 	"brianhang.me/interpreter/tokenize"
 )
 
-// statement       ::= while
-//                   | for
+// program         ::= (statement ';'?)*
+//
+// statement       ::= loop
+//                   | labeled
 //                   | return
-//                   | expression
+//                   | break
+//                   | continue
+//                   | throw
+//                   | try
+//                   | declaration
+//                   | expressionList
+//
+// declaration     ::= 'class' IDENTIFIER ('<' identifier)? '{' classAssignment* '}'
+//                   | 'func' IDENTIFIER '(' params? ')' block
+//                   | let
+//                   | const
+//
+// let             ::= 'let' IDENTIFIER ('=' expression)?
+// const           ::= 'const' IDENTIFIER '=' expression
 //
 // expression      ::= assignment
 //                   | block
 //                   | conditional
 //
 // conditional     ::= 'if' '(' expression ')' statement ('else' statement)?
+//
+// loop            ::= while
+//                   | doWhile
+//                   | for
+// labeled         ::= IDENTIFIER ':' loop
 // while           ::= 'while' '(' expression ')' statement
-// for             ::= 'for' '(' expression? ';' expression? ';' expression? ')' statement
+// doWhile         ::= 'do' statement 'while' '(' expression ')'
+// for             ::= 'for' '(' (let | expressionList)? ';' expression? ';' expressionList? ')' statement
+//                   | 'for' '(' (IDENTIFIER ',')? IDENTIFIER 'in' expression ')' statement
+//
+// block           ::= '{' (statement ';'?)* '}'
 //
-// block           ::= '{' statement* '}'
+// assignment      ::= (call '.')? IDENTIFIER ('=' | '+=' | '-=' | '*=' | '/=') assignment
+//                   | destructure
+//                   | disjunction
 //
-// assignment      ::= IDENTIFIER '=' assignment | disjunction
+// expressionList  ::= IDENTIFIER (',' pattern)+ '=' expression (',' expression)*
+//                   | destructure (',' expression)*
+//                   | expression
+//
+// destructure     ::= (arrayPattern | mapPattern) '=' expression
+// pattern         ::= IDENTIFIER | arrayPattern | mapPattern
+// arrayPattern    ::= '[' (pattern (',' pattern)* ','?)? ']'
+// mapPattern      ::= '{' (IDENTIFIER (',' IDENTIFIER)* ','?)? '}'
 //
-// params          ::= identifier (',' identifier)* ','?
+// params          ::= param (',' param)* ','?
+// param           ::= IDENTIFIER ('=' expression)?
+//                   | '...' IDENTIFIER
 // func            ::= 'func' '(' params? ')' block
 // return          ::= 'return' expression?
+// break           ::= 'break' IDENTIFIER?
+// continue        ::= 'continue' IDENTIFIER?
+// throw           ::= 'throw' expression
+// try             ::= 'try' block catch* ('finally' block)?
+// catch           ::= 'catch' '(' IDENTIFIER (':' IDENTIFIER)? ')' block
 //
 // class           ::= 'class' ('<' identifier)? '{' classAssignment* '}'
 // classAssignment ::= IDENTIFIER '=' (func | disjunction)
@@ -37,28 +77,66 @@ import (
 // term            ::= factor (('+' | '-') factor)*
 // factor          ::= unary (('*' | '/') unary)*
 // unary           ::= ('!' | '-') unary | call
-// args            ::= expression (',' expression)* ','?
+// args            ::= arg (',' arg)* ','?
+// arg             ::= (IDENTIFIER ':')? expression
 // call            ::= expresison2 ('(' args? ')' | '.' IDENTIFIER)*
 // expression2     ::= '(' expression ')'
 //                   | class
 //                   | func
+//                   | match
+//                   | 'this'
+//                   | 'super' '.' IDENTIFIER
 //                   | atom
+// match           ::= 'match' '(' expression ')' '{' (matchArm (',' matchArm)* ','?)? '}'
+// matchArm        ::= matchPattern ('if' expression)? '=>' expression
+// matchPattern    ::= '_'
+//                   | '-'? NUMBER | STRING | 'true' | 'false' | 'nil'
+//                   | IDENTIFIER mapPattern
+//                   | IDENTIFIER
+//                   | '[' (matchPattern (',' matchPattern)* ','?)? ']'
+//                   | mapPattern
 // atom            ::= IDENTIFIER
 //                   | NUMBER
 //                   | STRING
 //                   | 'true' | 'false'
 //                   | 'nil'
 
+// DefaultMaxDepth is how deeply statements, expressions and patterns can be
+// nested by default. It is far below the depth that would exhaust the stack.
+const DefaultMaxDepth = 1000
+
 type Parser struct {
-	tokens      *[]tokenize.TokenHolder
-	curTokenIdx int
+	tokens       *[]tokenize.TokenHolder
+	curTokenIdx  int
+	depth        int
+	maxDepth     int
+	loopLabels   []string
+	pendingLabel string
+	// classes holds whether each class being parsed has a parent class, from
+	// the outermost to the innermost.
+	classes []bool
+	// expected holds the tokens that were checked for at the token at index
+	// expectedAt, so that a syntax error there can list what would have been
+	// valid.
+	expected   []tokenize.TokenID
+	expectedAt int
+	// conditionStart is the index of the first token of the condition being
+	// parsed, if any.
+	conditionStart int
+	warnings       []error
 }
 
 func NewParser(tokens *[]tokenize.TokenHolder) *Parser {
-	parser := &Parser{tokens: tokens}
+	parser := &Parser{tokens: tokens, maxDepth: DefaultMaxDepth, conditionStart: -1}
 	return parser
 }
 
+// Warnings returns the warnings about the source parsed so far, for code that
+// parses but was probably meant differently.
+func (p *Parser) Warnings() []error {
+	return p.warnings
+}
+
 func (p *Parser) Parse() ([]Node, error) {
 	statements := make([]Node, 0)
 	for {
@@ -70,6 +148,7 @@ func (p *Parser) Parse() ([]Node, error) {
 			break
 		}
 		statements = append(statements, statement)
+		p.statementSeparator()
 	}
 	return statements, nil
 }
@@ -90,16 +169,128 @@ func (p *Parser) maybeStatement() (Node, error) {
 	if token == nil {
 		return nil, nil
 	}
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
 	switch token.GetID() {
 	case tokenize.TokenWhile:
 		return p.while()
+	case tokenize.TokenDo:
+		return p.doWhile()
 	case tokenize.TokenFor:
 		return p.forStatement()
 	case tokenize.TokenReturn:
 		return p.returnStatement()
-	default:
-		return p.maybeExpression()
+	case tokenize.TokenBreak:
+		return p.breakStatement()
+	case tokenize.TokenContinue:
+		return p.continueStatement()
+	case tokenize.TokenThrow:
+		return p.throwStatement()
+	case tokenize.TokenTry:
+		return p.tryStatement()
+	case tokenize.TokenIdentifier:
+		if colon := p.tokenAtOffset(1); colon != nil && colon.GetID() == tokenize.TokenColon {
+			return p.labeled()
+		}
+		p.checkKeywordTypo(token)
+	case tokenize.TokenLet:
+		return p.let()
+	case tokenize.TokenConst:
+		return p.constDeclaration()
+	case tokenize.TokenClass:
+		if p.isDeclaration() {
+			return p.classDeclaration()
+		}
+	case tokenize.TokenFunc:
+		if p.isDeclaration() {
+			return p.funcDeclaration()
+		}
+	}
+	return p.expressionList()
+}
+
+// expressionList parses an expression where a comma can't separate it from
+// another one, which is a statement or the initializer or update of a for
+// loop. There, a destructuring assignment can have several targets and values,
+// as in "a, b = b, a".
+func (p *Parser) expressionList() (Node, error) {
+	expr, err := p.maybeExpression()
+	if err != nil || expr == nil || !p.isTokenAtOffset(0, tokenize.TokenComma) {
+		return expr, err
+	}
+	switch n := expr.(type) {
+	case DestructureNode:
+		return p.moreValues(n)
+	case AssignmentNode, SetNode:
+		return p.moreValues(DestructureNode{Values: []ExpressionNode{n}})
+	}
+	// Elsewhere, the comma belongs to an enclosing list, as in "f(if (a) b, c)".
+	if !p.isTupleTarget() {
+		return expr, nil
+	}
+	first, ok := expr.(LiteralNode)
+	if !ok || first.Value.GetID() != tokenize.TokenIdentifier {
+		return expr, &InvalidAssignmentTargetError{target: expr.GetStartToken()}
+	}
+	tuple := TuplePatternNode{}
+	tuple.Elements = append(tuple.Elements, IdentifierPatternNode{Name: first.Value.(tokenize.IdentifierToken)})
+	for p.maybeMatch(tokenize.TokenComma) != nil {
+		element, err := p.pattern()
+		if err != nil {
+			return tuple, err
+		}
+		tuple.Elements = append(tuple.Elements, element)
 	}
+	node := DestructureNode{Pattern: tuple}
+	node.Equal, err = p.match(tokenize.TokenEqual)
+	if err != nil {
+		return node, err
+	}
+	value, err := p.expression()
+	node.Values = append(node.Values, value)
+	if err != nil {
+		return node, err
+	}
+	return p.moreValues(node)
+}
+
+// moreValues parses the values after the first one of a destructuring
+// assignment, which must have as many values as its pattern has targets. An
+// assignment that isn't destructuring is held by a node without a pattern, so
+// that its extra values can be reported.
+func (p *Parser) moreValues(node DestructureNode) (Node, error) {
+	for p.maybeMatch(tokenize.TokenComma) != nil {
+		value, err := p.expression()
+		if err != nil {
+			return node, err
+		}
+		node.Values = append(node.Values, value)
+	}
+	if node.Pattern == nil {
+		return node.Values[0], &AssignmentMismatchError{
+			assignment: node.Values[0],
+			targets:    1,
+			values:     node.Values,
+		}
+	}
+	targets := 1
+	switch pattern := node.Pattern.(type) {
+	case TuplePatternNode:
+		targets = len(pattern.Elements)
+	case ArrayPatternNode:
+		targets = len(pattern.Elements)
+	}
+	if len(node.Values) > 1 && len(node.Values) != targets {
+		return node, &AssignmentMismatchError{assignment: node, targets: targets, values: node.Values}
+	}
+	return node, checkBindings(node.Pattern)
+}
+
+func (p *Parser) isDeclaration() bool {
+	name := p.tokenAtOffset(1)
+	return name != nil && name.GetID() == tokenize.TokenIdentifier
 }
 
 func (p *Parser) expression() (ExpressionNode, error) {
@@ -113,23 +304,46 @@ func (p *Parser) expression() (ExpressionNode, error) {
 	return expression, nil
 }
 
+func (p *Parser) optionalExpression(closingToken tokenize.TokenID) (ExpressionNode, error) {
+	if close := p.peek(); close != nil && close.GetID() == closingToken {
+		return nil, nil
+	}
+	return p.expression()
+}
+
+func (p *Parser) optionalExpressionList(closingToken tokenize.TokenID) (ExpressionNode, error) {
+	if close := p.peek(); close != nil && close.GetID() == closingToken {
+		return nil, nil
+	}
+	expression, err := p.expressionList()
+	if err == nil && expression == nil {
+		return nil, &ExpectedExpressionError{last: p.last()}
+	}
+	return expression, err
+}
+
 func (p *Parser) maybeExpression() (Node, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
 	token := p.peek()
 	if token == nil {
 		return nil, nil
 	}
 	switch token.GetID() {
 	case tokenize.TokenLeftCurly:
-		return p.block()
+		if !p.isMapPattern() {
+			return p.block()
+		}
 	case tokenize.TokenClass:
-		return p.class()
+		return p.classExpr()
 	case tokenize.TokenIf:
 		return p.conditional()
 	case tokenize.TokenFunc:
 		return p.funcExpr()
-	default:
-		return p.assignment()
 	}
+	return p.assignment()
 }
 
 func (p *Parser) expression2() (ExpressionNode, error) {
@@ -137,11 +351,17 @@ func (p *Parser) expression2() (ExpressionNode, error) {
 	if token != nil {
 		switch token.GetID() {
 		case tokenize.TokenClass:
-			return p.class()
+			return p.classExpr()
 		case tokenize.TokenFunc:
 			return p.funcExpr()
 		case tokenize.TokenLeftParen:
 			return p.groupedExpr()
+		case tokenize.TokenMatch:
+			return p.matchExpr()
+		case tokenize.TokenThis:
+			return p.this()
+		case tokenize.TokenSuper:
+			return p.super()
 		}
 	}
 	return p.atom()
@@ -167,21 +387,60 @@ func (p *Parser) atom() (ExpressionNode, error) {
 	}
 	token := p.peek()
 	if token != nil {
-		return node, &UnexpectedTokenError{token: token}
+		return node, &UnexpectedTokenError{token: token, expected: p.expectedTokens()}
 	}
 	return node, &NoValueError{last: p.last()}
 }
 
-func (p *Parser) groupedExpr() (ExpressionNode, error) {
-	if _, err := p.match(tokenize.TokenLeftParen); err != nil {
-		return nil, err
+func (p *Parser) this() (ThisNode, error) {
+	var err error
+	node := ThisNode{}
+	node.This, err = p.matchIdentifier(tokenize.TokenThis)
+	if err != nil {
+		return node, err
 	}
-	expr, err := p.expression()
+	if len(p.classes) == 0 {
+		return node, &OutsideClassError{token: node.This}
+	}
+	return node, nil
+}
+
+func (p *Parser) super() (SuperNode, error) {
+	var err error
+	node := SuperNode{}
+	node.Super, err = p.matchIdentifier(tokenize.TokenSuper)
 	if err != nil {
-		return expr, err
+		return node, err
+	}
+	if len(p.classes) == 0 {
+		return node, &OutsideClassError{token: node.Super}
+	}
+	if !p.classes[len(p.classes)-1] {
+		return node, &NoParentClassError{token: node.Super}
+	}
+	if _, err = p.match(tokenize.TokenDot); err != nil {
+		return node, err
+	}
+	node.Method, err = p.matchIdentifier(tokenize.TokenIdentifier)
+	if err != nil {
+		return node, err
+	}
+	return node, nil
+}
+
+func (p *Parser) groupedExpr() (GroupNode, error) {
+	var err error
+	node := GroupNode{}
+	node.LeftParen, err = p.match(tokenize.TokenLeftParen)
+	if err != nil {
+		return node, err
 	}
-	_, err = p.match(tokenize.TokenRightParen)
-	return expr, err
+	node.Expression, err = p.expression()
+	if err != nil {
+		return node, err
+	}
+	node.RightParen, err = p.matchClosing(node.LeftParen, tokenize.TokenRightParen)
+	return node, err
 }
 
 var unaryOperatorTokenIDs = []tokenize.TokenID{
@@ -195,20 +454,29 @@ func (p *Parser) call() (ExpressionNode, error) {
 	if err != nil {
 		return node, err
 	}
+	// Each call and lookup nests the expression before it one level deeper.
+	levels := 0
+	defer func() { p.depth -= levels }()
 	isFindingCalls := true
 	for isFindingCalls {
 		nextToken := p.peek()
 		if nextToken == nil {
 			break
 		}
+		if id := nextToken.GetID(); id == tokenize.TokenLeftParen || id == tokenize.TokenDot {
+			if err := p.enter(); err != nil {
+				return node, err
+			}
+			levels++
+		}
 		switch nextToken.GetID() {
 		case tokenize.TokenLeftParen:
 			call := CallNode{Function: node, LeftParen: p.consume()}
-			call.Args, err = p.expressionList(p.expression, tokenize.TokenRightParen)
+			call.Args, err = p.args(call.LeftParen)
 			if err != nil {
 				return call, err
 			}
-			call.RightParen, err = p.match(tokenize.TokenRightParen)
+			call.RightParen, err = p.matchClosing(call.LeftParen, tokenize.TokenRightParen)
 			if err != nil {
 				return call, err
 			}
@@ -228,39 +496,114 @@ func (p *Parser) call() (ExpressionNode, error) {
 	return node, nil
 }
 
-func (p *Parser) expressionList(
-	getExpression func() (ExpressionNode, error),
-	closingToken tokenize.TokenID,
-) ([]ExpressionNode, error) {
-	expressions := make([]ExpressionNode, 0)
-	isFirstExpr := true
+// list parses the comma separated items after opening, up to but not
+// including the closing token.
+func (p *Parser) list(opening tokenize.TokenHolder, closingToken tokenize.TokenID, parseItem func() error) error {
+	isFirstItem := true
 	for {
-		close := p.peek()
-		if close != nil && close.GetID() == closingToken {
+		if p.check(closingToken) {
 			break
 		}
-		if !isFirstExpr {
-			_, err := p.match(tokenize.TokenComma)
-			if err != nil {
-				return expressions, err
+		if !isFirstItem {
+			if p.maybeMatch(tokenize.TokenComma) == nil {
+				return p.expectedTokenError(tokenize.TokenComma, opening)
 			}
 			// Trailing comma
-			close := p.peek()
-			if close != nil && close.GetID() == closingToken {
+			if p.check(closingToken) {
 				break
 			}
 		}
-		expr, err := getExpression()
+		if err := parseItem(); err != nil {
+			return err
+		}
+		isFirstItem = false
+	}
+	return nil
+}
+
+func (p *Parser) args(leftParen tokenize.TokenHolder) ([]ArgNode, error) {
+	var args []ArgNode
+	names := make(map[string]tokenize.IdentifierToken)
+	err := p.list(leftParen, tokenize.TokenRightParen, func() error {
+		var err error
+		arg := ArgNode{}
+		if p.isTokenAtOffset(0, tokenize.TokenIdentifier) && p.isTokenAtOffset(1, tokenize.TokenColon) {
+			arg.Name = p.consume().(tokenize.IdentifierToken)
+			arg.Colon = p.consume()
+			if previous, ok := names[arg.Name.GetValue()]; ok {
+				return &DuplicateNameError{name: arg.Name, previous: previous}
+			}
+			names[arg.Name.GetValue()] = arg.Name
+		}
+		arg.Value, err = p.expression()
+		if err != nil {
+			return err
+		}
+		if arg.Colon == nil && len(names) > 0 {
+			return &PositionalArgAfterNamedError{arg: arg}
+		}
+		args = append(args, arg)
+		return nil
+	})
+	return args, err
+}
+
+func (p *Parser) params(leftParen tokenize.TokenHolder) ([]ParamNode, error) {
+	var params []ParamNode
+	names := make(map[string]tokenize.IdentifierToken)
+	hasDefault := false
+	err := p.list(leftParen, tokenize.TokenRightParen, func() error {
+		if len(params) > 0 && params[len(params)-1].Ellipsis != nil {
+			return &VariadicParamNotLastError{param: params[len(params)-1]}
+		}
+		param, err := p.param()
+		if err != nil {
+			return err
+		}
+		if previous, ok := names[param.Name.GetValue()]; ok {
+			return &DuplicateNameError{name: param.Name, previous: previous}
+		}
+		names[param.Name.GetValue()] = param.Name
+		if param.Default != nil {
+			hasDefault = true
+		} else if hasDefault && param.Ellipsis == nil {
+			return &RequiredParamAfterDefaultError{param: param}
+		}
+		params = append(params, param)
+		return nil
+	})
+	return params, err
+}
+
+func (p *Parser) param() (ParamNode, error) {
+	node := ParamNode{}
+	node.Ellipsis = p.maybeMatch(tokenize.TokenEllipsis)
+	name := p.maybeMatch(tokenize.TokenIdentifier)
+	if name == nil {
+		actual, err := p.atom()
 		if err != nil {
-			return expressions, err
+			return node, err
 		}
-		expressions = append(expressions, expr)
-		isFirstExpr = false
+		return node, &InvalidFuncParamError{actual: actual}
+	}
+	node.Name = name.(tokenize.IdentifierToken)
+	if node.Ellipsis != nil {
+		return node, nil
 	}
-	return expressions, nil
+	node.Equal = p.maybeMatch(tokenize.TokenEqual)
+	if node.Equal == nil {
+		return node, nil
+	}
+	var err error
+	node.Default, err = p.expression()
+	return node, err
 }
 
 func (p *Parser) unary() (ExpressionNode, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
 	var err error
 	var operator tokenize.TokenHolder
 	for _, tokenID := range unaryOperatorTokenIDs {
@@ -340,6 +683,8 @@ func (p *Parser) binaryExpression(
 	if err != nil {
 		return node, err
 	}
+	levels := 0
+	defer func() { p.depth -= levels }()
 	for {
 		var operator tokenize.TokenHolder
 		for _, tokenID := range operatorTokenIDs {
@@ -351,6 +696,10 @@ func (p *Parser) binaryExpression(
 		if operator == nil {
 			break
 		}
+		if err := p.enter(); err != nil {
+			return node, err
+		}
+		levels++
 		binExprNode := BinaryExprNode{Operator: operator.GetToken(), LHS: node}
 		binExprNode.RHS, err = getOperand()
 		if err != nil {
@@ -361,13 +710,27 @@ func (p *Parser) binaryExpression(
 	return node, nil
 }
 
-func (p *Parser) class() (ClassNode, error) {
+func (p *Parser) classExpr() (ClassNode, error) {
+	return p.class(false)
+}
+
+func (p *Parser) classDeclaration() (ClassNode, error) {
+	return p.class(true)
+}
+
+func (p *Parser) class(isDeclaration bool) (ClassNode, error) {
 	var err error
 	node := ClassNode{}
 	node.Class, err = p.matchIdentifier(tokenize.TokenClass)
 	if err != nil {
 		return node, err
 	}
+	if isDeclaration {
+		node.Name, err = p.matchIdentifier(tokenize.TokenIdentifier)
+		if err != nil {
+			return node, err
+		}
+	}
 
 	node.Extends = p.maybeMatch(tokenize.TokenLess)
 	if node.Extends != nil {
@@ -380,6 +743,8 @@ func (p *Parser) class() (ClassNode, error) {
 	if node.BodyStart, err = p.match(tokenize.TokenLeftCurly); err != nil {
 		return node, err
 	}
+	p.classes = append(p.classes, node.Extends != nil)
+	defer func() { p.classes = p.classes[:len(p.classes)-1] }()
 	for {
 		identifier := p.maybeMatch(tokenize.TokenIdentifier)
 		if identifier == nil {
@@ -389,198 +754,804 @@ func (p *Parser) class() (ClassNode, error) {
 		if err != nil {
 			return node, err
 		}
-		value, err := p.expression()
+		var value ExpressionNode
+		if token := p.peek(); token != nil && token.GetID() == tokenize.TokenFunc {
+			value, err = p.funcExpr()
+		} else {
+			value, err = p.disjunction()
+		}
 		if err != nil {
 			return node, err
 		}
-		if value != nil {
-			value, err = p.disjunction()
-			if err != nil {
-				return node, err
-			}
-		}
 		assignment := AssignmentNode{LHS: identifier, Equal: equal, RHS: value}
 		node.Body = append(node.Body, assignment)
 	}
-	if node.BodyEnd, err = p.match(tokenize.TokenRightCurly); err != nil {
+	if node.BodyEnd, err = p.matchClosing(node.BodyStart, tokenize.TokenRightCurly); err != nil {
 		return node, err
 	}
 	return node, nil
 }
 
-func (p *Parser) returnStatement() (ReturnNode, error) {
+func (p *Parser) let() (LetNode, error) {
 	var err error
-	node := ReturnNode{}
-	node.Return, err = p.matchIdentifier(tokenize.TokenReturn)
+	node := LetNode{}
+	node.Let, err = p.matchIdentifier(tokenize.TokenLet)
 	if err != nil {
 		return node, err
 	}
-	node.Value, err = p.maybeExpression()
+	node.Name, err = p.matchIdentifier(tokenize.TokenIdentifier)
 	if err != nil {
 		return node, err
 	}
-	return node, nil
+	node.Equal = p.maybeMatch(tokenize.TokenEqual)
+	if node.Equal == nil {
+		return node, nil
+	}
+	node.Value, err = p.expression()
+	return node, err
 }
 
-func (p *Parser) funcExpr() (FuncNode, error) {
+func (p *Parser) constDeclaration() (ConstNode, error) {
 	var err error
-	node := FuncNode{}
-	node.Func, err = p.match(tokenize.TokenFunc)
-	if err != nil {
-		return node, err
-	}
-	node.LeftParen, err = p.match(tokenize.TokenLeftParen)
+	node := ConstNode{}
+	node.Const, err = p.matchIdentifier(tokenize.TokenConst)
 	if err != nil {
 		return node, err
 	}
-	paramNodes, err := p.expressionList(p.atom, tokenize.TokenRightParen)
+	node.Name, err = p.matchIdentifier(tokenize.TokenIdentifier)
 	if err != nil {
 		return node, err
 	}
-	node.RightParen, err = p.match(tokenize.TokenRightParen)
+	node.Equal, err = p.match(tokenize.TokenEqual)
 	if err != nil {
 		return node, err
 	}
-	for _, paramNode := range paramNodes {
-		literalNode, ok := paramNode.(LiteralNode)
-		if !ok || literalNode.Value.GetID() != tokenize.TokenIdentifier {
-			return node, &InvalidFuncParamError{actual: paramNode}
-		}
-		node.Params = append(node.Params, literalNode.Value.(tokenize.IdentifierToken))
-	}
-	node.Body, err = p.block()
+	node.Value, err = p.expression()
 	return node, err
 }
 
-func (p *Parser) assignment() (ExpressionNode, error) {
-	expr, err := p.disjunction()
-	if err != nil {
-		return expr, err
-	}
-	equal := p.maybeMatch(tokenize.TokenEqual)
-	if equal == nil {
-		return expr, nil
-	}
-	identifier, ok := expr.(LiteralNode)
-	if !ok || identifier.GetStartToken().GetID() != tokenize.TokenIdentifier {
-		return identifier, &InvalidAssignmentTargetError{
-			target: identifier.GetStartToken(),
-		}
-	}
-	assignment := AssignmentNode{LHS: identifier.Value, Equal: equal}
-	assignment.RHS, err = p.assignment()
-	if err != nil {
-		return assignment, err
-	}
-	return assignment, nil
-}
-
-func (p *Parser) block() (BlockNode, error) {
+func (p *Parser) returnStatement() (ReturnNode, error) {
 	var err error
-	node := BlockNode{}
-	if _, err = p.match(tokenize.TokenLeftCurly); err != nil {
+	node := ReturnNode{}
+	node.Return, err = p.matchIdentifier(tokenize.TokenReturn)
+	if err != nil {
 		return node, err
 	}
-	for {
-		if close := p.peek(); close != nil && close.GetID() == tokenize.TokenRightCurly {
-			break
-		}
-		statement, err := p.maybeStatement()
-		if err != nil {
-			return node, err
-		}
-		if statement == nil {
-			break
-		}
-		node.Children = append(node.Children, statement)
+	if p.isReturnEnd() {
+		return node, nil
 	}
-	if _, err = p.match(tokenize.TokenRightCurly); err != nil {
+	node.Value, err = p.maybeExpression()
+	if err != nil {
 		return node, err
 	}
 	return node, nil
 }
 
-func (p *Parser) forStatement() (ForNode, error) {
+func (p *Parser) throwStatement() (ThrowNode, error) {
 	var err error
-	node := ForNode{}
-	node.For, err = p.matchIdentifier(tokenize.TokenFor)
+	node := ThrowNode{}
+	node.Throw, err = p.matchIdentifier(tokenize.TokenThrow)
 	if err != nil {
 		return node, err
 	}
-	if _, err = p.match(tokenize.TokenLeftParen); err != nil {
-		return node, err
-	}
-	node.Init, err = p.maybeExpression()
+	node.Value, err = p.expression()
+	return node, err
+}
+
+func (p *Parser) tryStatement() (TryNode, error) {
+	var err error
+	node := TryNode{}
+	node.Try, err = p.matchIdentifier(tokenize.TokenTry)
 	if err != nil {
 		return node, err
 	}
-	if _, err = p.match(tokenize.TokenSemicolon); err != nil {
-		return node, err
-	}
-	node.Condition, err = p.maybeExpression()
+	node.Body, err = p.block()
 	if err != nil {
 		return node, err
 	}
-	if _, err = p.match(tokenize.TokenSemicolon); err != nil {
-		return node, err
-	}
-	node.Update, err = p.maybeExpression()
-	if err != nil {
-		return node, err
+	for p.check(tokenize.TokenCatch) {
+		catch, err := p.catch()
+		node.Catches = append(node.Catches, catch)
+		if err != nil {
+			return node, err
+		}
 	}
-	if _, err = p.match(tokenize.TokenRightParen); err != nil {
-		return node, err
+	if !p.check(tokenize.TokenFinally) && len(node.Catches) > 0 {
+		return node, nil
 	}
-	node.Body, err = p.statement()
+	node.Finally, err = p.matchIdentifier(tokenize.TokenFinally)
 	if err != nil {
 		return node, err
 	}
-	return node, nil
+	node.FinallyBody, err = p.block()
+	return node, err
 }
 
-func (p *Parser) while() (WhileNode, error) {
+func (p *Parser) catch() (CatchNode, error) {
 	var err error
-	node := WhileNode{}
-	node.While, err = p.matchIdentifier(tokenize.TokenWhile)
+	node := CatchNode{}
+	node.Catch, err = p.matchIdentifier(tokenize.TokenCatch)
 	if err != nil {
 		return node, err
 	}
 	if _, err = p.match(tokenize.TokenLeftParen); err != nil {
 		return node, err
 	}
-	node.Body, err = p.statement()
+	node.Name, err = p.matchIdentifier(tokenize.TokenIdentifier)
 	if err != nil {
 		return node, err
 	}
+	node.Colon = p.maybeMatch(tokenize.TokenColon)
+	if node.Colon != nil {
+		node.Class, err = p.matchIdentifier(tokenize.TokenIdentifier)
+		if err != nil {
+			return node, err
+		}
+	}
 	if _, err = p.match(tokenize.TokenRightParen); err != nil {
 		return node, err
 	}
-	return node, nil
+	node.Body, err = p.block()
+	return node, err
 }
 
-func (p *Parser) conditional() (ConditionalNode, error) {
+func (p *Parser) funcExpr() (FuncNode, error) {
+	return p.function(false)
+}
+
+func (p *Parser) funcDeclaration() (FuncNode, error) {
+	return p.function(true)
+}
+
+func (p *Parser) function(isDeclaration bool) (FuncNode, error) {
 	var err error
-	node := ConditionalNode{}
-	node.If, err = p.matchIdentifier(tokenize.TokenIf)
+	node := FuncNode{}
+	node.Func, err = p.match(tokenize.TokenFunc)
 	if err != nil {
 		return node, err
 	}
-	if _, err := p.match(tokenize.TokenLeftParen); err != nil {
-		return node, err
+	if isDeclaration {
+		node.Name, err = p.matchIdentifier(tokenize.TokenIdentifier)
+		if err != nil {
+			return node, err
+		}
 	}
-	node.Condition, err = p.expression()
+	loopLabels, pendingLabel := p.loopLabels, p.pendingLabel
+	p.loopLabels, p.pendingLabel = nil, ""
+	defer func() { p.loopLabels, p.pendingLabel = loopLabels, pendingLabel }()
+	node.LeftParen, err = p.match(tokenize.TokenLeftParen)
 	if err != nil {
 		return node, err
 	}
-	if _, err = p.match(tokenize.TokenRightParen); err != nil {
-		return node, err
-	}
-	node.TrueBody, err = p.statement()
+	node.Params, err = p.params(node.LeftParen)
 	if err != nil {
 		return node, err
 	}
-	node.Else = p.maybeMatch(tokenize.TokenElse)
-	if node.Else == nil {
+	node.RightParen, err = p.matchClosing(node.LeftParen, tokenize.TokenRightParen)
+	if err != nil {
+		return node, err
+	}
+	node.Body, err = p.block()
+	return node, err
+}
+
+func (p *Parser) assignment() (ExpressionNode, error) {
+	if p.isTokenAtOffset(0, tokenize.TokenLeftBracket) || p.isTokenAtOffset(0, tokenize.TokenLeftCurly) && p.isMapPattern() {
+		return p.destructure()
+	}
+	start := p.curTokenIdx
+	expr, err := p.disjunction()
+	if err != nil {
+		return expr, err
+	}
+	equal := p.peek()
+	if equal == nil || equal.GetID() != tokenize.TokenEqual && !isCompoundOperator(equal) {
+		return expr, nil
+	}
+	p.consume()
+	inCondition := start == p.conditionStart && equal.GetID() == tokenize.TokenEqual
+	// A variable or field in parentheses can still be assigned to.
+	switch target := Unparen(expr).(type) {
+	case LiteralNode:
+		if target.Value.GetID() != tokenize.TokenIdentifier {
+			break
+		}
+		p.warnAssignmentInCondition(inCondition, expr, equal)
+		assignment := AssignmentNode{LHS: target.Value, Equal: equal}
+		assignment.RHS, err = p.assignmentValue()
+		return assignment, err
+	case LookupNode:
+		p.warnAssignmentInCondition(inCondition, expr, equal)
+		set := SetNode{Object: target.Value, Key: target.Key, Equal: equal}
+		set.RHS, err = p.assignmentValue()
+		return set, err
+	}
+	return expr, &InvalidAssignmentTargetError{
+		target: expr.GetStartToken(),
+		// An assignment in a condition was most likely meant to be a
+		// comparison.
+		comparison: inCondition,
+		equal:      equal,
+	}
+}
+
+// warnAssignmentInCondition records a warning for an assignment that makes up a
+// whole condition. Wrapping the assignment in another pair of parentheses
+// marks it as intended and silences the warning.
+func (p *Parser) warnAssignmentInCondition(inCondition bool, target ExpressionNode, equal tokenize.TokenHolder) {
+	if _, ok := target.(GroupNode); inCondition && !ok {
+		p.warnings = append(p.warnings, &AssignmentInConditionWarning{equal: equal})
+	}
+}
+
+// compoundOperators maps each compound assignment operator to the binary
+// operator that it applies.
+var compoundOperators = map[tokenize.TokenID]tokenize.TokenID{
+	tokenize.TokenPlusEqual:  tokenize.TokenPlus,
+	tokenize.TokenMinusEqual: tokenize.TokenMinus,
+	tokenize.TokenStarEqual:  tokenize.TokenStar,
+	tokenize.TokenSlashEqual: tokenize.TokenSlash,
+}
+
+// CompoundOperator returns the binary operator applied by a compound
+// assignment such as +=, given its operator token, or false for a plain
+// assignment.
+func CompoundOperator(equal tokenize.TokenHolder) (tokenize.TokenID, bool) {
+	if equal == nil {
+		return 0, false
+	}
+	operator, ok := compoundOperators[equal.GetID()]
+	return operator, ok
+}
+
+func isCompoundOperator(token tokenize.TokenHolder) bool {
+	_, ok := CompoundOperator(token)
+	return ok
+}
+
+func (p *Parser) destructure() (DestructureNode, error) {
+	var err error
+	node := DestructureNode{}
+	node.Pattern, err = p.pattern()
+	if err != nil {
+		return node, err
+	}
+	node.Equal, err = p.match(tokenize.TokenEqual)
+	if err != nil {
+		return node, err
+	}
+	value, err := p.expression()
+	node.Values = append(node.Values, value)
+	if err != nil {
+		return node, err
+	}
+	return node, checkBindings(node.Pattern)
+}
+
+// checkBindings fails when a pattern binds the same name more than once.
+func checkBindings(pattern PatternNode) error {
+	names := make(map[string]tokenize.IdentifierToken)
+	for _, name := range PatternBindings(pattern) {
+		if previous, ok := names[name.GetValue()]; ok {
+			return &DuplicateNameError{name: name, previous: previous}
+		}
+		names[name.GetValue()] = name
+	}
+	return nil
+}
+
+func (p *Parser) pattern() (PatternNode, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	token := p.peek()
+	if token != nil {
+		switch token.GetID() {
+		case tokenize.TokenLeftBracket:
+			return p.arrayPattern(p.pattern)
+		case tokenize.TokenLeftCurly:
+			return p.mapPattern()
+		}
+	}
+	name, err := p.matchIdentifier(tokenize.TokenIdentifier)
+	return IdentifierPatternNode{Name: name}, err
+}
+
+func (p *Parser) arrayPattern(getElement func() (PatternNode, error)) (ArrayPatternNode, error) {
+	var err error
+	node := ArrayPatternNode{}
+	node.LeftBracket, err = p.match(tokenize.TokenLeftBracket)
+	if err != nil {
+		return node, err
+	}
+	err = p.list(node.LeftBracket, tokenize.TokenRightBracket, func() error {
+		element, err := getElement()
+		if err != nil {
+			return err
+		}
+		node.Elements = append(node.Elements, element)
+		return nil
+	})
+	if err != nil {
+		return node, err
+	}
+	node.RightBracket, err = p.matchClosing(node.LeftBracket, tokenize.TokenRightBracket)
+	return node, err
+}
+
+func (p *Parser) mapPattern() (MapPatternNode, error) {
+	var err error
+	node := MapPatternNode{}
+	node.LeftCurly, err = p.match(tokenize.TokenLeftCurly)
+	if err != nil {
+		return node, err
+	}
+	err = p.list(node.LeftCurly, tokenize.TokenRightCurly, func() error {
+		key, err := p.matchIdentifier(tokenize.TokenIdentifier)
+		if err != nil {
+			return err
+		}
+		node.Keys = append(node.Keys, key)
+		return nil
+	})
+	if err != nil {
+		return node, err
+	}
+	node.RightCurly, err = p.matchClosing(node.LeftCurly, tokenize.TokenRightCurly)
+	return node, err
+}
+
+func (p *Parser) matchExpr() (MatchNode, error) {
+	var err error
+	node := MatchNode{}
+	node.Match, err = p.matchIdentifier(tokenize.TokenMatch)
+	if err != nil {
+		return node, err
+	}
+	if _, err = p.match(tokenize.TokenLeftParen); err != nil {
+		return node, err
+	}
+	node.Value, err = p.expression()
+	if err != nil {
+		return node, err
+	}
+	if _, err = p.match(tokenize.TokenRightParen); err != nil {
+		return node, err
+	}
+	node.LeftCurly, err = p.match(tokenize.TokenLeftCurly)
+	if err != nil {
+		return node, err
+	}
+	err = p.list(node.LeftCurly, tokenize.TokenRightCurly, func() error {
+		arm, err := p.matchArm()
+		if err != nil {
+			return err
+		}
+		node.Arms = append(node.Arms, arm)
+		return nil
+	})
+	if err != nil {
+		return node, err
+	}
+	node.RightCurly, err = p.matchClosing(node.LeftCurly, tokenize.TokenRightCurly)
+	return node, err
+}
+
+func (p *Parser) matchArm() (MatchArmNode, error) {
+	var err error
+	node := MatchArmNode{}
+	node.Pattern, err = p.matchPattern()
+	if err != nil {
+		return node, err
+	}
+	node.If = p.maybeMatch(tokenize.TokenIf)
+	if node.If != nil {
+		node.Guard, err = p.expression()
+		if err != nil {
+			return node, err
+		}
+	}
+	node.Arrow, err = p.match(tokenize.TokenArrow)
+	if err != nil {
+		return node, err
+	}
+	node.Body, err = p.expression()
+	return node, err
+}
+
+var literalPatternTokenIDs = []tokenize.TokenID{
+	tokenize.TokenNumber,
+	tokenize.TokenString,
+	tokenize.TokenTrue,
+	tokenize.TokenFalse,
+	tokenize.TokenNil,
+}
+
+func (p *Parser) matchPattern() (PatternNode, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	if minus := p.maybeMatch(tokenize.TokenMinus); minus != nil {
+		value, err := p.match(tokenize.TokenNumber)
+		return LiteralPatternNode{Minus: minus, Value: value}, err
+	}
+	for _, tokenID := range literalPatternTokenIDs {
+		if value := p.maybeMatch(tokenID); value != nil {
+			return LiteralPatternNode{Value: value}, nil
+		}
+	}
+	token := p.peek()
+	if token == nil || token.GetID() != tokenize.TokenIdentifier {
+		if token != nil && token.GetID() == tokenize.TokenLeftBracket {
+			return p.arrayPattern(p.matchPattern)
+		}
+		return p.pattern()
+	}
+	name := p.consume().(tokenize.IdentifierToken)
+	if name.GetValue() == "_" {
+		return WildcardPatternNode{Underscore: name}, nil
+	}
+	if !p.isTokenAtOffset(0, tokenize.TokenLeftCurly) {
+		return IdentifierPatternNode{Name: name}, nil
+	}
+	var err error
+	node := ClassPatternNode{Class: name}
+	node.Fields, err = p.mapPattern()
+	return node, err
+}
+
+// Both blocks and map patterns start with '{', so this looks ahead for the
+// closing '}' of a map pattern followed by '='.
+func (p *Parser) isMapPattern() bool {
+	offset := 1
+	for p.isTokenAtOffset(offset, tokenize.TokenIdentifier) {
+		offset++
+		if !p.isTokenAtOffset(offset, tokenize.TokenComma) {
+			break
+		}
+		offset++
+	}
+	return p.isTokenAtOffset(offset, tokenize.TokenRightCurly) &&
+		p.isTokenAtOffset(offset+1, tokenize.TokenEqual)
+}
+
+// isTupleTarget reports whether the tokens from the current comma are the
+// rest of a tuple pattern followed by '='.
+func (p *Parser) isTupleTarget() bool {
+	offset := 0
+	for p.isTokenAtOffset(offset, tokenize.TokenComma) {
+		offset++
+		if p.isTokenAtOffset(offset, tokenize.TokenIdentifier) {
+			offset++
+			continue
+		}
+		if !p.isTokenAtOffset(offset, tokenize.TokenLeftBracket) && !p.isTokenAtOffset(offset, tokenize.TokenLeftCurly) {
+			return false
+		}
+		depth := 0
+		for {
+			token := p.tokenAtOffset(offset)
+			if token == nil {
+				return false
+			}
+			switch token.GetID() {
+			case tokenize.TokenLeftBracket, tokenize.TokenLeftCurly:
+				depth++
+			case tokenize.TokenRightBracket, tokenize.TokenRightCurly:
+				depth--
+			case tokenize.TokenIdentifier, tokenize.TokenComma:
+			default:
+				return false
+			}
+			offset++
+			if depth == 0 {
+				break
+			}
+		}
+	}
+	return offset > 0 && p.isTokenAtOffset(offset, tokenize.TokenEqual)
+}
+
+func (p *Parser) block() (BlockNode, error) {
+	node := BlockNode{}
+	bodyStart, err := p.match(tokenize.TokenLeftCurly)
+	if err != nil {
+		return node, err
+	}
+	node.BodyStart = bodyStart.GetToken()
+	for {
+		if p.check(tokenize.TokenRightCurly) {
+			break
+		}
+		statement, err := p.maybeStatement()
+		if err != nil {
+			return node, err
+		}
+		if statement == nil {
+			break
+		}
+		node.Children = append(node.Children, statement)
+		p.statementSeparator()
+	}
+	bodyEnd, err := p.matchClosing(bodyStart, tokenize.TokenRightCurly)
+	if err != nil {
+		return node, err
+	}
+	node.BodyEnd = bodyEnd.GetToken()
+	return node, nil
+}
+
+func (p *Parser) forStatement() (StatementNode, error) {
+	if p.isForIn() {
+		return p.forIn()
+	}
+	return p.forLoop()
+}
+
+func (p *Parser) isForIn() bool {
+	// Skip past the 'for' and '(' tokens.
+	offset := 2
+	if !p.isTokenAtOffset(offset, tokenize.TokenIdentifier) {
+		return false
+	}
+	offset++
+	if p.isTokenAtOffset(offset, tokenize.TokenComma) {
+		if !p.isTokenAtOffset(offset+1, tokenize.TokenIdentifier) {
+			return false
+		}
+		offset += 2
+	}
+	return p.isTokenAtOffset(offset, tokenize.TokenIn)
+}
+
+func (p *Parser) forIn() (ForInNode, error) {
+	var err error
+	node := ForInNode{}
+	node.For, err = p.matchIdentifier(tokenize.TokenFor)
+	if err != nil {
+		return node, err
+	}
+	if _, err = p.match(tokenize.TokenLeftParen); err != nil {
+		return node, err
+	}
+	node.Value, err = p.matchIdentifier(tokenize.TokenIdentifier)
+	if err != nil {
+		return node, err
+	}
+	if p.maybeMatch(tokenize.TokenComma) != nil {
+		node.Key = node.Value
+		node.Value, err = p.matchIdentifier(tokenize.TokenIdentifier)
+		if err != nil {
+			return node, err
+		}
+	}
+	node.In, err = p.matchIdentifier(tokenize.TokenIn)
+	if err != nil {
+		return node, err
+	}
+	node.Collection, err = p.expression()
+	if err != nil {
+		return node, err
+	}
+	if _, err = p.match(tokenize.TokenRightParen); err != nil {
+		return node, err
+	}
+	node.Body, err = p.loopBody()
+	if err != nil {
+		return node, err
+	}
+	return node, nil
+}
+
+func (p *Parser) forLoop() (ForNode, error) {
+	var err error
+	node := ForNode{}
+	node.For, err = p.matchIdentifier(tokenize.TokenFor)
+	if err != nil {
+		return node, err
+	}
+	if _, err = p.match(tokenize.TokenLeftParen); err != nil {
+		return node, err
+	}
+	if token := p.peek(); token != nil && token.GetID() == tokenize.TokenLet {
+		node.Init, err = p.let()
+	} else {
+		node.Init, err = p.optionalExpressionList(tokenize.TokenSemicolon)
+	}
+	if err != nil {
+		return node, err
+	}
+	if _, err = p.match(tokenize.TokenSemicolon); err != nil {
+		return node, err
+	}
+	node.Condition, err = p.optionalExpression(tokenize.TokenSemicolon)
+	if err != nil {
+		return node, err
+	}
+	if _, err = p.match(tokenize.TokenSemicolon); err != nil {
+		return node, err
+	}
+	node.Update, err = p.optionalExpressionList(tokenize.TokenRightParen)
+	if err != nil {
+		return node, err
+	}
+	if _, err = p.match(tokenize.TokenRightParen); err != nil {
+		return node, err
+	}
+	node.Body, err = p.loopBody()
+	if err != nil {
+		return node, err
+	}
+	return node, nil
+}
+
+func (p *Parser) while() (WhileNode, error) {
+	var err error
+	node := WhileNode{}
+	node.While, err = p.matchIdentifier(tokenize.TokenWhile)
+	if err != nil {
+		return node, err
+	}
+	if _, err = p.match(tokenize.TokenLeftParen); err != nil {
+		return node, err
+	}
+	node.Condition, err = p.condition()
+	if err != nil {
+		return node, err
+	}
+	if _, err = p.match(tokenize.TokenRightParen); err != nil {
+		return node, err
+	}
+	node.Body, err = p.loopBody()
+	if err != nil {
+		return node, err
+	}
+	return node, nil
+}
+
+func (p *Parser) doWhile() (DoWhileNode, error) {
+	var err error
+	node := DoWhileNode{}
+	node.Do, err = p.matchIdentifier(tokenize.TokenDo)
+	if err != nil {
+		return node, err
+	}
+	node.Body, err = p.loopBody()
+	if err != nil {
+		return node, err
+	}
+	node.While, err = p.matchIdentifier(tokenize.TokenWhile)
+	if err != nil {
+		return node, err
+	}
+	if _, err = p.match(tokenize.TokenLeftParen); err != nil {
+		return node, err
+	}
+	node.Condition, err = p.condition()
+	if err != nil {
+		return node, err
+	}
+	node.RightParen, err = p.match(tokenize.TokenRightParen)
+	if err != nil {
+		return node, err
+	}
+	return node, nil
+}
+
+func (p *Parser) loopBody() (StatementNode, error) {
+	p.loopLabels = append(p.loopLabels, p.pendingLabel)
+	p.pendingLabel = ""
+	defer func() { p.loopLabels = p.loopLabels[:len(p.loopLabels)-1] }()
+	return p.statement()
+}
+
+// assignmentValue parses the right hand side of an assignment, which nests
+// since assignments chain to the right.
+func (p *Parser) assignmentValue() (ExpressionNode, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	return p.assignment()
+}
+
+func (p *Parser) labeled() (LabeledNode, error) {
+	var err error
+	node := LabeledNode{}
+	node.Label, err = p.matchIdentifier(tokenize.TokenIdentifier)
+	if err != nil {
+		return node, err
+	}
+	node.Colon, err = p.match(tokenize.TokenColon)
+	if err != nil {
+		return node, err
+	}
+	loop := p.peek()
+	if loop == nil {
+		return node, &InvalidLabelError{label: node.Label}
+	}
+	p.pendingLabel = node.Label.GetValue()
+	defer func() { p.pendingLabel = "" }()
+	switch loop.GetID() {
+	case tokenize.TokenWhile:
+		node.Body, err = p.while()
+	case tokenize.TokenDo:
+		node.Body, err = p.doWhile()
+	case tokenize.TokenFor:
+		node.Body, err = p.forStatement()
+	default:
+		return node, &InvalidLabelError{label: node.Label}
+	}
+	return node, err
+}
+
+func (p *Parser) breakStatement() (BreakNode, error) {
+	var err error
+	node := BreakNode{}
+	node.Break, err = p.matchIdentifier(tokenize.TokenBreak)
+	if err != nil {
+		return node, err
+	}
+	node.Label, err = p.jumpLabel(node.Break)
+	return node, err
+}
+
+func (p *Parser) continueStatement() (ContinueNode, error) {
+	var err error
+	node := ContinueNode{}
+	node.Continue, err = p.matchIdentifier(tokenize.TokenContinue)
+	if err != nil {
+		return node, err
+	}
+	node.Label, err = p.jumpLabel(node.Continue)
+	return node, err
+}
+
+// Labels must be on the same line as the break or continue, since otherwise a
+// bare break followed by an expression statement would be ambiguous.
+func (p *Parser) jumpLabel(jump tokenize.IdentifierToken) (tokenize.IdentifierToken, error) {
+	var label tokenize.IdentifierToken
+	if len(p.loopLabels) == 0 {
+		return label, &OutsideLoopError{token: jump}
+	}
+	next := p.peek()
+	if next == nil || next.GetID() != tokenize.TokenIdentifier || next.GetLine() != jump.GetLine() {
+		return label, nil
+	}
+	label = p.consume().(tokenize.IdentifierToken)
+	for _, loopLabel := range p.loopLabels {
+		if loopLabel == label.GetValue() {
+			return label, nil
+		}
+	}
+	return label, &UndefinedLabelError{label: label}
+}
+
+func (p *Parser) conditional() (ConditionalNode, error) {
+	var err error
+	node := ConditionalNode{}
+	node.If, err = p.matchIdentifier(tokenize.TokenIf)
+	if err != nil {
+		return node, err
+	}
+	if _, err := p.match(tokenize.TokenLeftParen); err != nil {
+		return node, err
+	}
+	node.Condition, err = p.condition()
+	if err != nil {
+		return node, err
+	}
+	if _, err = p.match(tokenize.TokenRightParen); err != nil {
+		return node, err
+	}
+	node.TrueBody, err = p.statement()
+	if err != nil {
+		return node, err
+	}
+	node.Else = p.maybeMatch(tokenize.TokenElse)
+	if node.Else == nil {
 		return node, err
 	}
 	node.FalseBody, err = p.statement()
@@ -593,22 +1564,152 @@ func (p *Parser) conditional() (ConditionalNode, error) {
 func (p *Parser) match(id tokenize.TokenID) (tokenize.TokenHolder, error) {
 	token := p.maybeMatch(id)
 	if token == nil {
-		return nil, &ExpectedTokenError{
-			expected: id,
-			last:     p.last(),
-		}
+		return nil, p.expectedTokenError(id, nil)
+	}
+	return token, nil
+}
+
+// matchClosing matches the token that closes opening, such as the "}" of a
+// block, so that an error can point at the unclosed token.
+func (p *Parser) matchClosing(opening tokenize.TokenHolder, id tokenize.TokenID) (tokenize.TokenHolder, error) {
+	token := p.maybeMatch(id)
+	if token == nil {
+		return nil, p.expectedTokenError(id, opening)
 	}
 	return token, nil
 }
 
 func (p *Parser) maybeMatch(id tokenize.TokenID) tokenize.TokenHolder {
-	token := p.peek()
-	if token == nil || token.GetID() != id {
+	if !p.check(id) {
 		return nil
 	}
 	return p.consume()
 }
 
+// check reports whether the next token is id, remembering that id was
+// expected when it isn't.
+func (p *Parser) check(id tokenize.TokenID) bool {
+	if p.isTokenAtOffset(0, id) {
+		return true
+	}
+	if p.expectedAt != p.curTokenIdx {
+		p.expected = p.expected[:0]
+		p.expectedAt = p.curTokenIdx
+	}
+	p.expected = append(p.expected, id)
+	return false
+}
+
+// expectedTokens returns the tokens that were checked for at the next token.
+func (p *Parser) expectedTokens() []tokenize.TokenID {
+	if p.expectedAt != p.curTokenIdx {
+		return nil
+	}
+	expected := make([]tokenize.TokenID, 0, len(p.expected))
+	for _, id := range p.expected {
+		if !containsToken(expected, id) {
+			expected = append(expected, id)
+		}
+	}
+	return expected
+}
+
+// expectedTokenError returns the error for a missing id, listing the other
+// tokens that would have been valid after it.
+func (p *Parser) expectedTokenError(id tokenize.TokenID, opening tokenize.TokenHolder) *ExpectedTokenError {
+	expected := []tokenize.TokenID{id}
+	for _, other := range p.expectedTokens() {
+		if other != id {
+			expected = append(expected, other)
+		}
+	}
+	err := &ExpectedTokenError{expected: expected, last: p.last(), opening: opening}
+	if name, ok := p.peek().(tokenize.IdentifierToken); ok && name.GetID() == tokenize.TokenIdentifier {
+		if keyword, ok := suggestKeyword(name.GetValue(), expected); ok {
+			err.typo, err.suggestion = name, keyword
+		}
+	}
+	return err
+}
+
+// namedKeywords are the keywords that start a statement and are followed by a
+// name, as in "func f() {}" or "return x".
+var namedKeywords = []tokenize.TokenID{
+	tokenize.TokenFunc,
+	tokenize.TokenClass,
+	tokenize.TokenLet,
+	tokenize.TokenConst,
+	tokenize.TokenReturn,
+	tokenize.TokenThrow,
+	tokenize.TokenBreak,
+	tokenize.TokenContinue,
+}
+
+// conditionKeywords are the keywords that start a statement and are followed
+// by a condition in parentheses and a body, as in "while (x) {}".
+var conditionKeywords = []tokenize.TokenID{
+	tokenize.TokenIf,
+	tokenize.TokenWhile,
+	tokenize.TokenFor,
+	tokenize.TokenMatch,
+}
+
+// checkKeywordTypo records a warning if the name starting a statement looks
+// like a misspelled keyword and is followed by what would come after that
+// keyword. Both "fucn f() {}" and "whiel (x) {}" still parse, as a name
+// followed by a call and a block.
+func (p *Parser) checkKeywordTypo(token tokenize.TokenHolder) {
+	name, ok := token.(tokenize.IdentifierToken)
+	next := p.tokenAtOffset(1)
+	if !ok || next == nil || next.GetLine() != token.GetLine() {
+		return
+	}
+	// In "fucn f() {}", "f" is the name after the misspelled keyword rather
+	// than a misspelled "if".
+	if previous := p.tokenAtOffset(-1); previous != nil && previous.GetID() == tokenize.TokenIdentifier && previous.GetLine() == token.GetLine() {
+		return
+	}
+	var keywords []tokenize.TokenID
+	switch next.GetID() {
+	case tokenize.TokenIdentifier:
+		keywords = namedKeywords
+	case tokenize.TokenLeftParen:
+		if p.isParenthesizedBody(1) {
+			keywords = conditionKeywords
+		}
+	}
+	if keyword, ok := suggestKeyword(name.GetValue(), keywords); ok {
+		p.warnings = append(p.warnings, &KeywordTypoWarning{name: name, keyword: keyword})
+	}
+}
+
+// isParenthesizedBody reports whether the "(" at the given offset is closed by
+// a ")" directly followed by "{".
+func (p *Parser) isParenthesizedBody(offset int) bool {
+	depth := 0
+	for token := p.tokenAtOffset(offset); token != nil; token = p.tokenAtOffset(offset) {
+		switch token.GetID() {
+		case tokenize.TokenLeftParen:
+			depth++
+		case tokenize.TokenRightParen:
+			depth--
+			if depth == 0 {
+				return p.isTokenAtOffset(offset+1, tokenize.TokenLeftCurly)
+			}
+		}
+		offset++
+	}
+	return false
+}
+
+// condition parses the condition of an if or a loop.
+func (p *Parser) condition() (ExpressionNode, error) {
+	conditionStart := p.conditionStart
+	p.conditionStart = p.curTokenIdx
+	defer func() { p.conditionStart = conditionStart }()
+	return p.expression()
+}
+
 func (p *Parser) matchIdentifier(id tokenize.TokenID) (tokenize.IdentifierToken, error) {
 	token, err := p.match(id)
 	identifier, ok := token.(tokenize.IdentifierToken)
@@ -619,7 +1720,7 @@ func (p *Parser) matchIdentifier(id tokenize.TokenID) (tokenize.IdentifierToken,
 		return identifier, nil
 	}
 	return identifier, &ExpectedTokenError{
-		expected: id,
+		expected: []tokenize.TokenID{id},
 		actual:   token,
 		last:     p.last(),
 	}
@@ -633,6 +1734,30 @@ func (p *Parser) tokenAtOffset(offset int) tokenize.TokenHolder {
 	return (*p.tokens)[idx]
 }
 
+func (p *Parser) isTokenAtOffset(offset int, id tokenize.TokenID) bool {
+	token := p.tokenAtOffset(offset)
+	return token != nil && token.GetID() == id
+}
+
+// enter guards the functions that parse recursively, failing once the input
+// is nested deeper than the parser's limit. Each call must be paired with a
+// deferred call to leave.
+func (p *Parser) enter() error {
+	if p.depth < p.maxDepth {
+		p.depth++
+		return nil
+	}
+	token := p.peek()
+	if token == nil {
+		token = p.last()
+	}
+	return &TooDeeplyNestedError{token: token, maxDepth: p.maxDepth}
+}
+
+func (p *Parser) leave() {
+	p.depth--
+}
+
 func (p *Parser) peek() tokenize.TokenHolder {
 	return p.tokenAtOffset(0)
 }
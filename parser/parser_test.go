@@ -1,10 +1,13 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"runtime"
 	"strings"
 	"testing"
 
+	"brianhang.me/interpreter/diagnostic"
 	"brianhang.me/interpreter/tokenize"
 	"github.com/stretchr/testify/assert"
 )
@@ -26,6 +29,90 @@ func TestParser(t *testing.T) {
 			"y = func(x){ x = x + 1 return x + 'hello' }",
 			"[(= y (func x (block [(= x (+ (identifier x) (number 1))) (return (+ (identifier x) (string \"hello\")))])))]",
 		},
+		{
+			"a.b.c = d",
+			"[(set (lookup (identifier a) b) c (identifier d))]",
+		},
+		{
+			"f().x = y.z = 1",
+			"[(set (call (identifier f)) x (set (identifier y) z (number 1)))]",
+		},
+		{
+			"class < Base { init = func(x) { this.x = x } get = func() { return super.get() + this.x } }",
+			"[(class Base [(= init (func x (block [(set (this) x (identifier x))]))) (= get (func (block [(return (+ (call (super get)) (lookup (this) x)))])))])]",
+		},
+		{
+			"func fact(n) { return n * fact(n - 1) } class Point < Base { } class Empty {}",
+			"[(func fact: n (block [(return (* (identifier n) (call (identifier fact) (- (identifier n) (number 1)))))])) (class Point: Base []) (class Empty: [])]",
+		},
+		{
+			"{ func(x) { x } func inner() {} }",
+			"[(block [(func x (block [(identifier x)])) (func inner: (block []))])]",
+		},
+		{
+			"let x let y = 1 const z = y + 1 for (let i = 0; i < z; i = i + 1) {}",
+			"[(let x) (let y (number 1)) (const z (+ (identifier y) (number 1))) (for (let i (number 0)) (< (identifier i) (identifier z)) (= i (+ (identifier i) (number 1))) (block []))]",
+		},
+		{
+			"while (x < 3) { x = x + 1 }",
+			"[(while (< (identifier x) (number 3)) (block [(= x (+ (identifier x) (number 1)))]))]",
+		},
+		{
+			"do { x = f() } while (x)",
+			"[(do (block [(= x (call (identifier f)))]) while (identifier x))]",
+		},
+		{
+			"outer: while (a) { for (;;) { if (b) break outer else continue } }",
+			"[(label outer (while (identifier a) (block [(for nil nil nil (block [(if (identifier b) (break outer) else (continue))]))])))]",
+		},
+		{
+			"(a) = (b); (c.d) = -(1 + 2)",
+			"[(= a (identifier b)) (set (identifier c) d (- (+ (number 1) (number 2))))]",
+		},
+		{
+			"x += 1 a.b -= c *= 2 x /= -y",
+			"[(+= x (number 1)) (set (identifier a) b -= (*= c (number 2))) (/= x (- (identifier y)))]",
+		},
+		{
+			"f = func(a, b = 2, ...rest,) { } f(1, b: 3, c: a = 4,)",
+			"[(= f (func a (b = (number 2)) ...rest (block []))) (call (identifier f) (number 1) (b: (number 3)) (c: (= a (number 4))))]",
+		},
+		{
+			"[a, [b, c],] = pair {x, y} = point a, b = b, a { z } q, [r] = f()",
+			"[(destructure (array a (array b c)) (identifier pair)) (destructure (map x y) (identifier point)) (destructure (tuple a b) (identifier b) (identifier a)) (block [(identifier z)]) (destructure (tuple q (array r)) (call (identifier f)))]",
+		},
+		{
+			"for ([i, j] = pair; i < j; i, j = i + 1, j - 1) { } f([a] = b, c)",
+			"[(for (destructure (array i j) (identifier pair)) (< (identifier i) (identifier j)) (destructure (tuple i j) (+ (identifier i) (number 1)) (- (identifier j) (number 1))) (block [])) (call (identifier f) (destructure (array a) (identifier b)) (identifier c))]",
+		},
+		{
+			"for (item in items) print(item) for (k, v in m) { continue }",
+			"[(for-in item (identifier items) (call (identifier print) (identifier item))) (for-in k v (identifier m) (block [(continue)]))]",
+		},
+		{
+			"rows: for (row in table.rows()) for (i = 0; i < 2; i = i + 1) break rows",
+			"[(label rows (for-in row (call (lookup (identifier table) rows)) (for (= i (number 0)) (< (identifier i) (number 2)) (= i (+ (identifier i) (number 1))) (break rows))))]",
+		},
+		{
+			"loop: do { while (a) { continue loop } break\nloop } while (b)",
+			"[(label loop (do (block [(while (identifier a) (block [(continue loop)])) (break) (identifier loop)]) while (identifier b)))]",
+		},
+		{
+			"y = match (x) { -1 => a, [-2.5, b] => b, _ => nil }",
+			"[(= y (match (identifier x) [(=> (number -1) (identifier a)) (=> (array (number -2.5) b) (identifier b)) (=> _ (nil ))]))]",
+		},
+		{
+			"y = match (x) { 0 => \"zero\", [a, 1] => a, Point {x, y} if x == y => x, {z} => z, n => n, _ => nil, }",
+			"[(= y (match (identifier x) [(=> (number 0) (string \"zero\")) (=> (array a (number 1)) (identifier a)) (=> (instance Point (map x y)) if (== (identifier x) (identifier y)) (identifier x)) (=> (map z) (identifier z)) (=> n (identifier n)) (=> _ (nil ))]))]",
+		},
+		{
+			"f(if (a) b, c) f(if (a) b else c, d)",
+			"[(call (identifier f) (if (identifier a) (identifier b)) (identifier c)) (call (identifier f) (if (identifier a) (identifier b) else (identifier c)) (identifier d))]",
+		},
+		{
+			"try { f() } catch (e: NotFound) { throw e } catch (e) { } finally { close() } try { return } finally { }",
+			"[(try (block [(call (identifier f))]) (catch e: NotFound (block [(throw (identifier e))])) (catch e (block [])) finally (block [(call (identifier close))])) (try (block [(return nil)]) finally (block []))]",
+		},
 	}
 	for _, test := range cases {
 		tokenizer := tokenize.NewTokenizer(strings.NewReader(test.source))
@@ -42,3 +129,904 @@ func TestParser(t *testing.T) {
 		assert.Equal(t, test.expectedAST, fmt.Sprintf("%s", nodes))
 	}
 }
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		source        string
+		expectedError string
+	}{
+		{"f() = 1", "Invalid left hand side for assignment on line 1 at column 1"},
+		{"1 = x", "Invalid left hand side for assignment on line 1 at column 1"},
+		{"a.b. = c", "Expected token \"identifier\" near line 1 and column 4"},
+		{"f = func() { return this }", "Cannot use \"this\" outside of a class body on line 1 at column 21"},
+		{"super.init()", "Cannot use \"super\" outside of a class body on line 1 at column 1"},
+		{"class < Base { f = super }", "Expected token \".\" near line 1 and column 20"},
+		{"class Foo { f = func() { super.f() } }", "Cannot use \"super\" in a class without a parent class on line 1 at column 26"},
+		{"class < Base { f = class { g = super.g } }", "Cannot use \"super\" in a class without a parent class on line 1 at column 32"},
+		{"x = func named() {}", "Expected token \"(\" near line 1 and column 5"},
+		{"class Foo < { }", "Expected token \"identifier\" near line 1 and column 11"},
+		{"const x", "Expected token \"=\" near line 1 and column 7"},
+		{"let = 1", "Expected token \"identifier\" near line 1 and column 1"},
+		{"while (x) { } break", "Cannot use \"break\" outside of a loop on line 1 at column 15"},
+		{"while (x) { f = func() { continue } }", "Cannot use \"continue\" outside of a loop on line 1 at column 26"},
+		{"a: while (x) { } while (y) { break a }", "Undefined label \"a\" on line 1 at column 36"},
+		{"a: x = 1", "Label \"a\" on line 1 at column 1 must be followed by a loop"},
+		{"for (a, in b) {}", "Expected \";\" or an operator near line 1 and column 6"},
+		{"for (x in) {}", "Unexpected token \")\" on line 1 at column 10, expected an expression"},
+		{"func(a, 1) {}", "Expected an identifier for a function param, but got \"1\" on line 1 at column 9"},
+		{"func(a = 1, b) {}", "Parameter \"b\" on line 1 at column 13 needs a default value since it follows a parameter with one"},
+		{"func(...a, b) {}", "Variadic parameter \"a\" on line 1 at column 9 must be the last parameter"},
+		{"func(a, b, a) {}", "Duplicate name \"a\" on line 1 at column 12, it was already used on line 1 at column 6"},
+		{"f(a: 1, a: 2)", "Duplicate name \"a\" on line 1 at column 9, it was already used on line 1 at column 3"},
+		{"f(a: 1, 2)", "Positional argument on line 1 at column 9 cannot follow a named argument"},
+		{"func(...a = 1) {}", "Expected \",\" or \")\" near line 1 and column 9 for the \"(\" opened on line 1 at column 5"},
+		{"[a, 1] = b", "Expected \"identifier\" or \"]\" near line 1 and column 3"},
+		{"a.b, c = d", "Invalid left hand side for assignment on line 1 at column 1"},
+		{"[a, a] = x", "Duplicate name \"a\" on line 1 at column 5, it was already used on line 1 at column 2"},
+		{"a, {a} = x", "Duplicate name \"a\" on line 1 at column 5, it was already used on line 1 at column 1"},
+		{"x = 1, 2", "Assignment on line 1 at column 1 has 1 target but 2 values"},
+		{"a.b = 1, 2, 3", "Assignment on line 1 at column 1 has 1 target but 3 values"},
+		{"{x} = 1, 2", "Assignment on line 1 at column 1 has 1 target but 2 values"},
+		{"a, b = 1, 2, 3", "Assignment on line 1 at column 1 has 2 targets but 3 values"},
+		{"[a, b, c] = 1, 2", "Assignment on line 1 at column 1 has 3 targets but 2 values"},
+		{"f() += 1", "Invalid left hand side for assignment on line 1 at column 1"},
+		{"[a] += b", "Expected token \"=\" near line 1 and column 3"},
+		{"a, b", "Unexpected token \",\" on line 1 at column 2, expected an operator or an expression"},
+		{"{x, y = 1", "Expected \"}\", \",\" or an operator near line 1 and column 9 for the \"{\" opened on line 1 at column 1"},
+		{"do x", "Expected \"while\" or an operator near line 1 and column 4"},
+		{"match x { }", "Expected token \"(\" near line 1 and column 1"},
+		{"match (x) { 1 2 }", "Expected \"=>\" or \"if\" near line 1 and column 13"},
+		{"try { }", "Expected \"finally\" or \"catch\" near line 1 and column 7"},
+		{"try { } catch e { }", "Expected token \"(\" near line 1 and column 9"},
+		{"try { } catch (e: 1) { }", "Expected token \"identifier\" near line 1 and column 17"},
+		{"throw", "Expected an expression near line 1"},
+		{"match (x) { - => 1 }", "Expected token \"number\" near line 1 and column 13"},
+		{"match (x) { -a => 1 }", "Expected token \"number\" near line 1 and column 13"},
+		{"match (x) { a => b c => d }", "Expected \",\", \"}\" or an operator near line 1 and column 18 for the \"{\" opened on line 1 at column 11"},
+		{"f(a b)", "Expected \",\", \")\" or an operator near line 1 and column 3 for the \"(\" opened on line 1 at column 2"},
+		{"x = (1 + 2", "Expected \")\" or an operator near line 1 and column 10 for the \"(\" opened on line 1 at column 5"},
+		{"while (x) {\n\tf()\n", "Expected \"}\" or an operator near line 2 and column 4 for the \"{\" opened on line 1 at column 11"},
+		{"x = 1 )", "Unexpected token \")\" on line 1 at column 7, expected an operator or an expression"},
+		{"do { } whiel (x)", "Expected token \"while\" near line 1 and column 6, did you mean \"while\" instead of \"whiel\"?"},
+		{"try { } finaly { }", "Expected \"finally\" or \"catch\" near line 1 and column 7, did you mean \"finally\" instead of \"finaly\"?"},
+		{"try { } x", "Expected \"finally\" or \"catch\" near line 1 and column 7"},
+		{"if (a + 1 = b) c", "Invalid left hand side for assignment on line 1 at column 5, did you mean \"==\" instead of \"=\" on line 1 at column 11?"},
+		{"while (f() = 1) { }", "Invalid left hand side for assignment on line 1 at column 8, did you mean \"==\" instead of \"=\" on line 1 at column 12?"},
+		{"if (a) f() = 1", "Invalid left hand side for assignment on line 1 at column 8"},
+		{"if (a + 1 += b) c", "Invalid left hand side for assignment on line 1 at column 5"},
+	}
+	for _, test := range cases {
+		tokenizer := tokenize.NewTokenizer(strings.NewReader(test.source))
+		tokens, err := tokenizer.Tokenize()
+		if err != nil {
+			t.Errorf("Failed to tokenize: %s\n", err)
+			continue
+		}
+		_, err = NewParser(&tokens).Parse()
+		if assert.Error(t, err, "Expected \"%s\" to fail to parse", test.source) {
+			assert.Equal(t, test.expectedError, err.Error())
+		}
+	}
+}
+
+func TestStatementSeparators(t *testing.T) {
+	cases := []struct {
+		source      string
+		expectedAST string
+	}{
+		{
+			"x; (y); -z; { return; f() } if (a) return else return b do return while (c)",
+			"[(identifier x) (identifier y) (- (identifier z)) (block [(return nil) (call (identifier f))]) (if (identifier a) (return nil) else (return (identifier b))) (do (return nil) while (identifier c))]",
+		},
+		{
+			"a; b; { c; d; } return; e return\nwhile (x) y",
+			"[(identifier a) (identifier b) (block [(identifier c) (identifier d)]) (return nil) (identifier e) (return nil) (while (identifier x) (identifier y))]",
+		},
+		{"x\n(y)", "[(call (identifier x) (identifier y))]"},
+		{"return\nx", "[(return (identifier x))]"},
+	}
+	for _, test := range cases {
+		for _, options := range []Options{{}, {Recover: true}} {
+			file, err := ParseString(test.source, options)
+			if assert.NoError(t, err, "Failed to parse %s", test.source) {
+				assert.Equal(t, test.expectedAST, fmt.Sprintf("%s", file.Nodes))
+			}
+		}
+	}
+
+	errorCases := []struct {
+		source        string
+		expectedError string
+	}{
+		{"a;; b", "Unexpected token \";\" on line 1 at column 3, expected an expression"},
+		{"if (a) return; else b", "Unexpected token \"else\" on line 1 at column 16, expected an expression"},
+		{"{ a;; }", "Unexpected token \";\" on line 1 at column 5, expected \"}\" or an expression"},
+	}
+	for _, test := range errorCases {
+		_, err := ParseString(test.source, Options{})
+		assert.EqualError(t, err, test.expectedError, "Wrong error for %s", test.source)
+	}
+}
+
+func TestSuggestKeyword(t *testing.T) {
+	expected := []tokenize.TokenID{tokenize.TokenFunc, tokenize.TokenFor, tokenize.TokenFinally, tokenize.TokenIdentifier}
+	cases := []struct {
+		name     string
+		expected string
+	}{
+		{"fucn", "func"},
+		{"fun", "func"},
+		{"fro", "for"},
+		{"finaly", "finally"},
+		{"fnialy", "finally"},
+		{"fork", "for"},
+		{"f", ""},
+		{"fuzzy", ""},
+	}
+	for _, test := range cases {
+		suggestion, ok := suggestKeyword(test.name, expected)
+		if test.expected == "" {
+			assert.False(t, ok, "Expected no suggestion for \"%s\"", test.name)
+		} else if assert.True(t, ok, "Expected a suggestion for \"%s\"", test.name) {
+			assert.Equal(t, test.expected, suggestion.String())
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	position := func(line, column int) tokenize.Position {
+		return tokenize.Position{Line: line, Column: column}
+	}
+	_, err := ParseString("while (x) {\n\tf(a b)", Options{})
+	var d *diagnostic.Diagnostic
+	if assert.True(t, errors.As(err, &d)) {
+		assert.Equal(t, diagnostic.Diagnostic{
+			Code:    CodeExpectedToken,
+			Message: err.Error(),
+			Span:    diagnostic.Span{Start: position(2, 5), End: position(2, 5)},
+			Label:   "expected \",\", \")\" or an operator",
+			Related: []diagnostic.Label{{
+				Span:    diagnostic.Span{Start: position(2, 3), End: position(2, 4)},
+				Message: "unclosed \"(\" opened here",
+			}},
+		}, *d)
+	}
+	var expected *ExpectedTokenError
+	assert.True(t, errors.As(err, &expected))
+
+	_, err = ParseString("x = (1 + 2", Options{})
+	if assert.True(t, errors.As(fmt.Errorf("main.lang: %w", err), &d)) {
+		assert.Equal(t, []diagnostic.Fix{{
+			Message: "Insert \")\"",
+			Edits:   []diagnostic.Edit{{Span: diagnostic.Span{Start: position(1, 11), End: position(1, 11)}, Text: ")"}},
+		}}, d.Fixes)
+	}
+
+	_, err = ParseString("do { } whiel (x)", Options{})
+	if assert.True(t, errors.As(err, &d)) {
+		assert.Equal(t, []diagnostic.Fix{{
+			Message: "Replace \"whiel\" with \"while\"",
+			Edits:   []diagnostic.Edit{{Span: diagnostic.Span{Start: position(1, 8), End: position(1, 13)}, Text: "while"}},
+		}}, d.Fixes)
+	}
+
+	_, err = ParseString("if (a + 1 = b) c", Options{})
+	if assert.True(t, errors.As(err, &d)) {
+		assert.Equal(t, CodeInvalidAssignmentTarget, d.Code)
+		assert.Equal(t, "==", d.Fixes[0].Edits[0].Text)
+		assert.Equal(t, position(1, 11), d.Fixes[0].Edits[0].Span.Start)
+	}
+
+	file, err := ParseString("const x = 1\nx = 2", Options{})
+	if assert.NoError(t, err) {
+		err = Resolve(file.Nodes)
+		if assert.True(t, errors.As(err, &d)) {
+			assert.Equal(t, diagnostic.SeverityError, d.Severity)
+			assert.Equal(t, CodeConstAssignment, d.Code)
+			assert.Equal(t, diagnostic.Span{Start: position(2, 1), End: position(2, 2)}, d.Span)
+			assert.Equal(t, "declared as a constant here", d.Related[0].Message)
+		}
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	cases := []struct {
+		source   string
+		expected []string
+	}{
+		{"if (x = 1) {}", []string{"Assignment used as a condition on line 1 at column 7, did you mean \"==\"?"}},
+		{"while (a.b = c) {}", []string{"Assignment used as a condition on line 1 at column 12, did you mean \"==\"?"}},
+		{"if ((x = 1)) {}", nil},
+		{"if (x == 1) {}", nil},
+		{"if (x += 1) {}", nil},
+		{"if (f(x = 1)) {}", nil},
+		{"fucn f() {}", []string{"Unknown name \"fucn\" on line 1 at column 1, did you mean \"func\"?"}},
+		{"whiel (x) {}", []string{"Unknown name \"whiel\" on line 1 at column 1, did you mean \"while\"?"}},
+		{"retrun x", []string{"Unknown name \"retrun\" on line 1 at column 1, did you mean \"return\"?"}},
+		{"whiel (x)\n{}", []string{"Unknown name \"whiel\" on line 1 at column 1, did you mean \"while\"?"}},
+		{"whiel\nx", nil},
+		{"fork (x) {}", []string{"Unknown name \"fork\" on line 1 at column 1, did you mean \"for\"?"}},
+		{"fork(x)", nil},
+		{"print x", nil},
+	}
+	for _, test := range cases {
+		file, err := ParseString(test.source, Options{})
+		if !assert.NoError(t, err, test.source) {
+			continue
+		}
+		var messages []string
+		for _, warning := range file.Warnings {
+			messages = append(messages, warning.Error())
+		}
+		assert.Equal(t, test.expected, messages, test.source)
+	}
+
+	file, _ := ParseString("if (x = 1) {}", Options{})
+	var d *diagnostic.Diagnostic
+	if assert.Len(t, file.Warnings, 1) && assert.True(t, errors.As(file.Warnings[0], &d)) {
+		assert.Equal(t, diagnostic.SeverityWarning, d.Severity)
+		assert.Equal(t, CodeAssignmentInCondition, d.Code)
+		assert.Equal(t, "==", d.Fixes[0].Edits[0].Text)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	cases := []struct {
+		source        string
+		expectedError string
+	}{
+		{"let x x = 1", ""},
+		{"let x { x = 2 let y y = x }", ""},
+		{"func f(a, b = a, ...c) { a = 1 c = b f = 2 }", ""},
+		{"class Point { x = 1 y = 2 }", ""},
+		{"for (let i = 0; i < 3; i = i + 1) { }", ""},
+		{"for (k, v in m) { k = v }", ""},
+		{"for (x in xs) { } x = 1", "Cannot assign to undeclared variable \"x\" on line 1 at column 19"},
+		{"let x = func() { x = 1 }", ""},
+		{"let a let b let c [a, {b, c}] = x a, b = b, a", ""},
+		{"let a [a, b] = x", "Cannot assign to undeclared variable \"b\" on line 1 at column 11"},
+		{"const a = 1 let b {a, b} = x", "Cannot assign to constant \"a\" on line 1 at column 20, it was declared on line 1"},
+		{"x = 1", "Cannot assign to undeclared variable \"x\" on line 1 at column 1"},
+		{"{ let y } y = 1", "Cannot assign to undeclared variable \"y\" on line 1 at column 11"},
+		{"for (let i = 0; i < 3; i = i + 1) { } i = 1", "Cannot assign to undeclared variable \"i\" on line 1 at column 39"},
+		{"const c = 1\nc = 2", "Cannot assign to constant \"c\" on line 2 at column 1, it was declared on line 1"},
+		{"const c = 1 func() { c = 2 }", "Cannot assign to constant \"c\" on line 1 at column 22, it was declared on line 1"},
+		{"let a\nlet a", "\"a\" on line 2 at column 5 is already declared in this scope on line 1"},
+		{"const a = 1 { let a a = 2 }", ""},
+		{"let x match (v) { [x, y] => func() { y = x }, _ => x = 1 }", ""},
+		{"match (v) { x => 1 } x = 2", "Cannot assign to undeclared variable \"x\" on line 1 at column 22"},
+		{"match (v) { Point {x} => x, n if n > 0 => n }", "Match on line 1 at column 1 checks for class instances, but has no arm for other values"},
+		{"match (v) { Point {} => 1, _ => 2 }", ""},
+		{"match (v) { 1 => 2 }", ""},
+		{"try { } catch (e) { e = 1 } e = 2", "Cannot assign to undeclared variable \"e\" on line 1 at column 29"},
+		{"let e try { } catch (e) { let e }", ""},
+	}
+	for _, test := range cases {
+		err := Resolve(parseString(t, test.source))
+		if test.expectedError == "" {
+			assert.NoError(t, err, "Expected \"%s\" to resolve", test.source)
+		} else if assert.Error(t, err, "Expected \"%s\" to fail to resolve", test.source) {
+			assert.Equal(t, test.expectedError, err.Error())
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	nodes := parseString(t, "x = 1 + 2 * 3 f(a, b) { y z }")
+	swapped := ApplyList(nodes, nil, func(c *Cursor) bool {
+		if binExpr, ok := c.Node().(BinaryExprNode); ok {
+			binExpr.LHS, binExpr.RHS = binExpr.RHS, binExpr.LHS
+			c.Replace(binExpr)
+		}
+		return true
+	})
+	assert.Equal(t, "[(= x (+ (* (number 3) (number 2)) (number 1))) (call (identifier f) (identifier a) (identifier b)) (block [(identifier y) (identifier z)])]", fmt.Sprintf("%s", swapped))
+	assert.Equal(t, "[(= x (+ (number 1) (* (number 2) (number 3)))) (call (identifier f) (identifier a) (identifier b)) (block [(identifier y) (identifier z)])]", fmt.Sprintf("%s", nodes))
+
+	edited := ApplyList(nodes, func(c *Cursor) bool {
+		if c.Index() < 0 {
+			return true
+		}
+		switch c.Node().GetStartToken().String() {
+		case "a":
+			c.InsertBefore(c.Node())
+			c.InsertAfter(c.Node())
+		case "b", "y":
+			c.Delete()
+		case "z":
+			c.Replace(nodes[1].(CallNode).Args[1].Value)
+		}
+		return true
+	}, nil)
+	assert.Equal(t, "[(= x (+ (number 1) (* (number 2) (number 3)))) (call (identifier f) (identifier a) (identifier a) (identifier a)) (block [(identifier b)])]", fmt.Sprintf("%s", edited))
+
+	var visited []string
+	ApplyList(nodes, func(c *Cursor) bool {
+		visited = append(visited, fmt.Sprintf("%s:%d", c.Name(), c.Index()))
+		_, isAssignment := c.Node().(AssignmentNode)
+		return !isAssignment
+	}, func(c *Cursor) bool {
+		_, isCall := c.Node().(CallNode)
+		return !isCall
+	})
+	assert.Equal(t, []string{":0", ":1", "Function:-1", "Args:0", "Value:-1", "Args:1", "Value:-1"}, visited)
+}
+
+func TestNodeSpans(t *testing.T) {
+	cases := []struct {
+		source        string
+		expectedStart tokenize.Position
+		expectedEnd   tokenize.Position
+	}{
+		{"foo", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 4}},
+		{"3.14", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 5}},
+		{"'str'", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 6}},
+		{"1 + 2 * 3", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 10}},
+		{"a >= b", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 7}},
+		{"x and y != z", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 13}},
+		{"!!true", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 7}},
+		{"-x", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 3}},
+		{"a.b.c", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 6}},
+		{"f(a, b)", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 8}},
+		{"f(a)(b).c", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 10}},
+		{"x = y = 1", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 10}},
+		{"a.b.c = d", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 10}},
+		{"(a + b) * c", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 12}},
+		{"x = ((y))", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 10}},
+		{"(f)(a).b", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 9}},
+		{"{}", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 3}},
+		{"{\n  a\n  b\n}", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 4, Column: 2}},
+		{"if (a) b", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 9}},
+		{"if (a) { b } else c", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 20}},
+		{"for (i = 0; i < 3; i = i + 1) { }", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 34}},
+		{"func(...a) { }", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 15}},
+		{"f(x, y: z = 3 + 4)", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 19}},
+		{"func(a, b = 1 + 2) { return a }", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 32}},
+		{"func(a, b) { return a }", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 24}},
+		{"func() {\n  return\n}", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 3, Column: 2}},
+		{"return", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 7}},
+		{"return x + 1", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 13}},
+		{"class { x = this.y }", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 21}},
+		{"class < A { x = super.y }", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 26}},
+		{"func f(a) {\n}", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 2, Column: 2}},
+		{"class Foo < Bar { }", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 20}},
+		{"let x", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 6}},
+		{"const x = 12", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 13}},
+		{"while (x) y", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 12}},
+		{"do { } while (x)", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 17}},
+		{"a: while (x) { break a }", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 25}},
+		{"while (x) { continue }", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 23}},
+		{"for (x in xs) { }", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 18}},
+		{"[a, b] = c", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 11}},
+		{"{a} = c", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 8}},
+		{"[a, b] = c, d", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 14}},
+		{"for ([a] = b; a; a, b = b, a) { }", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 34}},
+		{"a, b = c", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 9}},
+		{"class { }", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 10}},
+		{"class < Base { f = func() { } x = 1 }", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 38}},
+		{"throw x.y", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 10}},
+		{"try { } catch (e: Err) { }", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 27}},
+		{"try { } finally { }", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 20}},
+		{"match (x) { Point {a} if a => a }", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 34}},
+		{"match (x) { -1 => a }", tokenize.Position{Line: 1, Column: 1}, tokenize.Position{Line: 1, Column: 22}},
+	}
+	for _, test := range cases {
+		nodes := parseString(t, test.source)
+		if !assert.Equal(t, 1, len(nodes), "Expected \"%s\" to have one node", test.source) {
+			continue
+		}
+		node := nodes[0]
+		assert.Equal(t, test.expectedStart, node.Pos(), "Wrong start for \"%s\"", test.source)
+		assert.Equal(t, test.expectedEnd, node.End(), "Wrong end for \"%s\"", test.source)
+		ApplyList(nodes, func(c *Cursor) bool {
+			parent := c.Parent()
+			if parent == nil {
+				return true
+			}
+			child := c.Node()
+			assert.False(
+				t,
+				isBefore(child.Pos(), parent.Pos()) || isBefore(parent.End(), child.End()),
+				"Span of %s (%s-%s) is outside of its parent %s (%s-%s)",
+				child, child.Pos(), child.End(), parent, parent.Pos(), parent.End(),
+			)
+			return true
+		}, nil)
+	}
+}
+
+func TestNestingLimit(t *testing.T) {
+	cases := []struct {
+		source        string
+		expectedError string
+	}{
+		{strings.Repeat("(", 100000) + "1", "Source is nested more than 1000 levels deep on line 1 at column 500"},
+		{strings.Repeat("!", 100000) + "x", "Source is nested more than 1000 levels deep on line 1 at column 999"},
+		{strings.Repeat("{", 100000), "Source is nested more than 1000 levels deep on line 1 at column 501"},
+		{strings.Repeat("[", 100000), "Source is nested more than 1000 levels deep on line 1 at column 999"},
+		{strings.Repeat("-", 1500), "Source is nested more than 1000 levels deep on line 1 at column 999"},
+		{strings.Repeat("x = ", 200000) + "1", "Source is nested more than 1000 levels deep on line 1 at column 3993"},
+		{strings.Repeat("a.b = ", 200000) + "1", "Source is nested more than 1000 levels deep on line 1 at column 5984"},
+	}
+	for _, test := range cases {
+		_, err := ParseString(test.source, Options{})
+		if assert.Error(t, err) {
+			assert.IsType(t, &TooDeeplyNestedError{}, err)
+			assert.Equal(t, test.expectedError, err.Error(), "Wrong error for %.10s", test.source)
+		}
+	}
+
+	for _, source := range []string{
+		"a" + strings.Repeat(".b", 200000),
+		"f" + strings.Repeat("()", 200000),
+		"1" + strings.Repeat(" + 1", 200000),
+		"x = a" + strings.Repeat(" or a", 200000),
+	} {
+		_, err := ParseString(source, Options{})
+		assert.IsType(t, &TooDeeplyNestedError{}, err, "Wrong error for %.10s", source)
+	}
+	for _, source := range []string{
+		"let a a" + strings.Repeat(".b", 900),
+		"let f f" + strings.Repeat("()", 900),
+		"let a let x x = a" + strings.Repeat(" + a", 900),
+	} {
+		file, err := ParseString(source, Options{})
+		if assert.NoError(t, err, "Failed to parse %.10s", source) {
+			assert.NoError(t, Resolve(file.Nodes))
+		}
+	}
+
+	nested := strings.Repeat("(", 10) + "1" + strings.Repeat(")", 10)
+	_, err := ParseString(nested, Options{})
+	assert.NoError(t, err)
+	_, err = ParseString(nested, Options{MaxDepth: 5})
+	assert.IsType(t, &TooDeeplyNestedError{}, err)
+	_, err = ParseExpression(strings.Repeat("(", 100000))
+	assert.IsType(t, &TooDeeplyNestedError{}, err)
+
+	file, err := ParseString(strings.Repeat("((((((((((((1\n", 9)+"x = 1", Options{Recover: true, MaxDepth: 10})
+	assert.Equal(t, "[(= x (number 1))]", fmt.Sprintf("%s", file.Nodes))
+	if assert.IsType(t, ErrorList{}, err) {
+		assert.Len(t, err, 9)
+		for i, err := range err.(ErrorList) {
+			assert.IsType(t, &TooDeeplyNestedError{}, err)
+			assert.Equal(t, fmt.Sprintf("Source is nested more than 10 levels deep on line %d at column 5", i+1), err.Error())
+		}
+	}
+
+	_, err = ParseString("x = 1 + 2", Options{Limits: tokenize.Limits{MaxTokens: 4}})
+	assert.EqualError(t, err, "Input has more than the limit of 4 tokens, reached on line 1 at column 9")
+	_, err = ParseString("x = 1 + 2", Options{Limits: tokenize.Limits{MaxInputSize: 8}})
+	assert.EqualError(t, err, "Input is larger than the limit of 8 bytes")
+	_, err = ParseString("x = 1 + 2", Options{Limits: tokenize.Limits{MaxInputSize: 9, MaxTokens: 5}})
+	assert.NoError(t, err)
+}
+
+func TestInspect(t *testing.T) {
+	nodes := parseString(t, "class Foo < Bar { f = func(a = 1) { try { [b] = a } catch (e) { } } } y = match (x) { [_, n] if n => -n, _ => (nil) } for (k, v in m) { o.k = v }")
+	var applied []Node
+	ApplyList(nodes, func(c *Cursor) bool {
+		applied = append(applied, c.Node())
+		return true
+	}, nil)
+	var inspected []Node
+	depth := 0
+	for _, node := range nodes {
+		Inspect(node, func(n Node) bool {
+			if n == nil {
+				depth--
+				return false
+			}
+			inspected = append(inspected, n)
+			depth++
+			return true
+		})
+	}
+	assert.Equal(t, applied, inspected)
+	assert.Equal(t, 0, depth)
+}
+
+func TestPathEnclosing(t *testing.T) {
+	nodes := parseString(t, "let total = 0\nfor (item in cart.items) {\n  total = total + item.price * 2\n}")
+	cases := []struct {
+		start        tokenize.Position
+		end          tokenize.Position
+		expectedPath []string
+	}{
+		{
+			tokenize.Position{Line: 3, Column: 20},
+			tokenize.Position{Line: 3, Column: 20},
+			[]string{"ForIn", "Block", "Assignment", "BinaryExpr", "BinaryExpr", "Lookup", "Literal"},
+		},
+		{
+			tokenize.Position{Line: 3, Column: 19},
+			tokenize.Position{Line: 3, Column: 33},
+			[]string{"ForIn", "Block", "Assignment", "BinaryExpr", "BinaryExpr"},
+		},
+		{
+			tokenize.Position{Line: 2, Column: 14},
+			tokenize.Position{Line: 2, Column: 24},
+			[]string{"ForIn", "Lookup"},
+		},
+		{
+			tokenize.Position{Line: 1, Column: 1},
+			tokenize.Position{Line: 1, Column: 4},
+			[]string{"Let"},
+		},
+		{
+			tokenize.Position{Line: 3, Column: 1},
+			tokenize.Position{Line: 3, Column: 2},
+			[]string{"ForIn", "Block"},
+		},
+		{
+			tokenize.Position{Line: 1, Column: 5},
+			tokenize.Position{Line: 2, Column: 2},
+			[]string{},
+		},
+	}
+	for _, test := range cases {
+		path := []string{}
+		for _, node := range PathEnclosing(nodes, test.start, test.end) {
+			path = append(path, strings.TrimSuffix(strings.TrimPrefix(fmt.Sprintf("%T", node), "parser."), "Node"))
+		}
+		assert.Equal(t, test.expectedPath, path, "Wrong path from %s to %s", test.start, test.end)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	sources := []string{
+		"x = -1 + 2 * 3 y = !(x == \"a\" or x != nil and true)",
+		"if (a) b else { c }",
+		"class Foo < Bar { init = func(a, b = 0, ...rest) { super.init(a, b: 1) return this.x } }",
+		"func f() { return } f()",
+		"outer: for (let i = 0; ; i = i + 1) { for (k, v in m) { continue outer } break }",
+		"do { a.b = c } while (false)",
+		"let a const b = 2 [a, {c}] = d, e a, b = b, a",
+		"y = match (x) { 0 => \"\", Point {x} if x > 0 => x, [_, n] => n, _ => nil }",
+		"try { throw e } catch (e: Err) { } finally { }",
+	}
+	for _, source := range sources {
+		nodes := parseString(t, source)
+		data, err := MarshalJSON(nodes)
+		if !assert.NoError(t, err, "Failed to marshal \"%s\"", source) {
+			continue
+		}
+		decoded, err := UnmarshalJSON(data)
+		if !assert.NoError(t, err, "Failed to unmarshal \"%s\"", source) {
+			continue
+		}
+		assert.Equal(t, nodes, decoded)
+	}
+
+	data, err := MarshalJSON(parseString(t, "x = 1"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"version": 1, "nodes": [{
+		"kind": "Assignment",
+		"pos": {"line": 1, "column": 1},
+		"end": {"line": 1, "column": 6},
+		"LHS": {"token": "identifier", "value": "x", "pos": {"line": 1, "column": 1}, "end": {"line": 1, "column": 2}},
+		"Equal": {"token": "=", "pos": {"line": 1, "column": 3}, "end": {"line": 1, "column": 4}},
+		"RHS": {
+			"kind": "Literal",
+			"pos": {"line": 1, "column": 5},
+			"end": {"line": 1, "column": 6},
+			"Value": {"token": "number", "value": 1, "pos": {"line": 1, "column": 5}, "end": {"line": 1, "column": 6}}
+		},
+		"Doc": null
+	}]}`, string(data))
+
+	errorCases := []struct {
+		data          string
+		expectedError string
+	}{
+		{`{"version": 2, "nodes": []}`, "Unsupported JSON AST version 2, expected version 1"},
+		{`{"version": 1, "nodes": [null]}`, "Invalid JSON AST at nodes[0]: expected a node"},
+		{`{"version": 1, "nodes": [{"kind": "Nope"}]}`, "Invalid JSON AST at nodes[0]: unknown node kind \"Nope\""},
+		{`{"version": 1, "nodes": [{"kind": "Param", "Name": {"token": "("}}]}`, "Invalid JSON AST at nodes[0].Name: expected an identifier or keyword token"},
+		{`{"version": 1, "nodes": [{"kind": "Call", "Function": {"kind": "This", "This": {"token": "this"}}, "LeftParen": {"token": "("}, "Args": [{"kind": "Block"}]}]}`, "Invalid JSON AST at nodes[0].Args[0]: expected ArgNode, got \"Block\""},
+		{`{"version": 1, "nodes": [{"kind": "BinaryExpr"}]}`, "Invalid JSON AST at nodes[0].LHS: missing required field"},
+		{`{"version": 1, "nodes": [{"kind": "Literal", "Value": null}]}`, "Invalid JSON AST at nodes[0].Value: missing required field"},
+		{`{"version": 1, "nodes": [{"kind": "Match", "Match": {"token": "match"}, "Value": {"kind": "This", "This": {"token": "this"}}, "LeftCurly": {"token": "{"}, "Arms": [{"kind": "MatchArm"}], "RightCurly": {"token": "}"}}]}`, "Invalid JSON AST at nodes[0].Arms[0].Pattern: missing required field"},
+		{`{"version": 1, "nodes": [{"kind": "Assignment", "LHS": {"token": "("}}]}`, "Invalid JSON AST at nodes[0].LHS: unexpected token \"(\""},
+		{`{"version": 1, "nodes": [{"kind": "Param", "Name": {"token": "while"}}]}`, "Invalid JSON AST at nodes[0].Name: unexpected token \"while\""},
+		{`{"version": 1, "nodes": [{"kind": "This", "This": {"token": "this"}, "Self": null}]}`, "Invalid JSON AST at nodes[0]: unknown field \"Self\""},
+	}
+	for _, test := range errorCases {
+		_, err := UnmarshalJSON([]byte(test.data))
+		if assert.Error(t, err, "Expected %s to fail to unmarshal", test.data) {
+			assert.Equal(t, test.expectedError, err.Error())
+		}
+	}
+}
+
+func TestParseExpression(t *testing.T) {
+	cases := []struct {
+		source        string
+		expectedAST   string
+		expectedError string
+	}{
+		{"price * (1 + tax)", "(* (identifier price) (+ (number 1) (identifier tax)))", ""},
+		{"max(a, b: 2)", "(call (identifier max) (identifier a) (b: (number 2)))", ""},
+		{"a b", "", "Unexpected token \"b\" on line 1 at column 3"},
+		{"a; b", "", "Unexpected token \";\" on line 1 at column 2"},
+		{"", "", "Expected an expression"},
+		{"let x = 1", "", "Unexpected token \"let\" on line 1 at column 1, expected an expression"},
+	}
+	for _, test := range cases {
+		expression, err := ParseExpression(test.source)
+		if test.expectedError != "" {
+			if assert.Error(t, err, "Expected \"%s\" to fail to parse", test.source) {
+				assert.Equal(t, test.expectedError, err.Error())
+			}
+			continue
+		}
+		if assert.NoError(t, err) {
+			assert.Equal(t, test.expectedAST, expression.String())
+		}
+	}
+
+	_, err := ParseExpressionWith("((((1))))", Options{MaxDepth: 3})
+	assert.IsType(t, &TooDeeplyNestedError{}, err)
+	_, err = ParseExpressionWith("(((((", Options{Limits: tokenize.Limits{MaxTokens: 3}})
+	assert.EqualError(t, err, "Input has more than the limit of 3 tokens, reached on line 1 at column 4")
+	_, err = ParseExpressionWith("1 + 2", Options{Limits: tokenize.Limits{MaxInputSize: 4}})
+	assert.EqualError(t, err, "Input is larger than the limit of 4 bytes")
+	_, err = ParseExpressionWith("1", Options{Version: LatestVersion + 1})
+	assert.IsType(t, &UnsupportedVersionError{}, err)
+	expression, err := ParseExpressionWith("a.b(c)", Options{MaxDepth: 6, Limits: tokenize.Limits{MaxTokens: 6}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "(call (lookup (identifier a) b) (identifier c))", expression.String())
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	file, err := ParseFile("a.txt", strings.NewReader("x = 1 // one"), Options{Comments: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "a.txt", file.Name)
+		assert.Equal(t, "[(= x (number 1))]", fmt.Sprintf("%s", file.Nodes))
+		if assert.Len(t, file.Comments, 1) {
+			assert.Equal(t, "// one", file.Comments[0].GetValue())
+		}
+	}
+
+	file, err = ParseString("x = 1 // one", Options{})
+	assert.NoError(t, err)
+	assert.Empty(t, file.Comments)
+
+	_, err = ParseString("x = ", Options{})
+	assert.EqualError(t, err, "Expected a value near line 1 at column 3, but none was provided")
+
+	file, err = ParseString("x = = 1\ny = 2\nf(,) let z = 3 { w = } q = 4", Options{Recover: true})
+	assert.Equal(t, "[(= y (number 2)) (let z (number 3)) (= q (number 4))]", fmt.Sprintf("%s", file.Nodes))
+	if assert.IsType(t, ErrorList{}, err) {
+		assert.Len(t, err, 3)
+		assert.Equal(t, "Unexpected token \"=\" on line 1 at column 5, expected an expression", err.(ErrorList)[0].Error())
+	}
+
+	file, err = ParseString("x = 1\ny = (((", Options{Recover: true})
+	assert.Equal(t, "[(= x (number 1))]", fmt.Sprintf("%s", file.Nodes))
+	if assert.IsType(t, ErrorList{}, err) {
+		assert.Len(t, err, 1)
+	}
+
+	_, err = ParseString("x = 1", Options{Version: LatestVersion + 1})
+	assert.EqualError(t, err, fmt.Sprintf("Unsupported language version %d, the latest version is %d", LatestVersion+1, LatestVersion))
+}
+
+func TestAttachDocs(t *testing.T) {
+	source := `/// Adds two numbers.
+///
+/// Returns their sum.
+func add(a, b) { return a + b }
+
+// Not a doc comment.
+let x = 1
+
+/**
+ * A point in space.
+ *   Indented.
+ */
+class Point {
+	/// The x coordinate.
+	x = 0
+	y = 0
+}
+
+/// Doubles n.
+double = func(n) { return n * 2 }
+/// Detached.
+
+const z = 1
+
+y = 2 /// Trails y.
+after = 3
+/** Same line. */ func same() { }
+v = 4 /** After v. */ func notAlone() { }
+`
+	file, err := ParseString(source, Options{Comments: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	docs := make([]string, 0)
+	ApplyList(file.Nodes, func(c *Cursor) bool {
+		switch n := c.Node().(type) {
+		case FuncNode:
+			docs = append(docs, n.Name.String()+": "+DocText(n.Doc))
+		case LetNode:
+			docs = append(docs, n.Name.String()+": "+DocText(n.Doc))
+		case ConstNode:
+			docs = append(docs, n.Name.String()+": "+DocText(n.Doc))
+		case ClassNode:
+			docs = append(docs, n.Name.String()+": "+DocText(n.Doc))
+		case AssignmentNode:
+			docs = append(docs, n.LHS.String()+": "+DocText(n.Doc))
+		}
+		return true
+	}, nil)
+	assert.Equal(t, []string{
+		"add: Adds two numbers.\n\nReturns their sum.",
+		"x: ",
+		"Point: A point in space.\n  Indented.",
+		"x: The x coordinate.",
+		"y: ",
+		"double: Doubles n.",
+		": ",
+		"z: ",
+		"y: ",
+		"after: ",
+		"same: Same line.",
+		"v: ",
+		"notAlone: ",
+	}, docs)
+
+	data, err := MarshalJSON(file.Nodes)
+	assert.NoError(t, err)
+	decoded, err := UnmarshalJSON(data)
+	assert.NoError(t, err)
+	assert.Equal(t, file.Nodes, decoded)
+	assert.Equal(t, file.Nodes, Compact(file.Nodes).Nodes())
+}
+
+func TestArena(t *testing.T) {
+	sources := []string{
+		"x = -1 + 2 * 3 y = !(x == \"a\" or x != nil and true) z = .5",
+		"class Foo < Bar { init = func(a, b = 0, ...rest) { super.init(a, b: 1) return this.x } }",
+		"func f() { return } f()",
+		"outer: for (let i = 0; ; i = i + 1) { for (k, v in m) { continue outer } break }",
+		"let a const b = 2 [a, {c}] = d, e a, b = b, a",
+		"y = match (x) { 0 => \"\", Point {x} if x > 0 => x, [_, n] => n, _ => nil }",
+		"try { throw e } catch (e: Err) { } finally { }",
+	}
+	for _, source := range sources {
+		nodes := parseString(t, source)
+		arena := Compact(nodes)
+		assert.Equal(t, nodes, arena.Nodes(), "Failed to compact \"%s\"", source)
+
+		tokens, err := tokenize.NewTokenizer(strings.NewReader(source)).Tokenize()
+		assert.NoError(t, err)
+		parsed, err := NewParser(&tokens).ParseCompact()
+		assert.NoError(t, err)
+		assert.Equal(t, nodes, parsed.Nodes(), "Failed to parse \"%s\" compactly", source)
+
+		if assert.Equal(t, len(nodes), arena.Len()) {
+			for i, node := range nodes {
+				root := arena.Root(i)
+				assert.Equal(t, node, root.Node())
+				assert.Equal(t, node.Pos(), root.Pos())
+				assert.Equal(t, node.End(), root.End())
+				assert.Equal(t, node.GetStartToken(), root.GetStartToken())
+				assert.Equal(t, node.GetEndToken(), root.GetEndToken())
+				assert.Equal(t, node.String(), root.String())
+			}
+		}
+	}
+
+	arena := Compact(parseString(t, "let x x = 1 + 2"))
+	roots := []Node{arena.Root(0), arena.Root(1)}
+	assert.NoError(t, Resolve(roots))
+	count := 0
+	Inspect(roots[1], func(n Node) bool {
+		if n != nil {
+			count++
+		}
+		return true
+	})
+	assert.Equal(t, 4, count)
+	rewritten := ApplyList(roots, nil, func(c *Cursor) bool {
+		if _, ok := c.Node().(BinaryExprNode); ok {
+			c.Replace(LiteralNode{Value: tokenize.NewNumberToken(3, tokenize.Position{}, tokenize.Position{})})
+		}
+		return true
+	})
+	assert.Equal(t, "[(let x) (= x (number 3))]", fmt.Sprintf("%s", rewritten))
+	assert.Error(t, Resolve([]Node{Compact(parseString(t, "let x x = 1")).Root(1)}))
+
+	arena = Compact(parseString(t, "f(a, b + 1)"))
+	call := arena.Root(0)
+	assert.Equal(t, "Call", call.Kind())
+	children := call.Children()
+	if assert.Len(t, children, 3) {
+		assert.Equal(t, "Literal", children[0].Kind())
+		assert.Equal(t, "Arg", children[1].Kind())
+		assert.Equal(t, tokenize.Position{Line: 1, Column: 6}, children[2].Pos())
+		assert.Equal(t, "(+ (identifier b) (number 1))", children[2].Children()[0].String())
+	}
+}
+
+func parseString(t *testing.T, source string) []Node {
+	tokenizer := tokenize.NewTokenizer(strings.NewReader(source))
+	tokens, err := tokenizer.Tokenize()
+	if err != nil {
+		t.Fatalf("Failed to tokenize \"%s\": %s", source, err)
+	}
+	nodes, err := NewParser(&tokens).Parse()
+	if err != nil {
+		t.Fatalf("Failed to parse \"%s\": %s", source, err)
+	}
+	return nodes
+}
+
+// generatedSource is a large program like the generated scripts that the
+// compact representation is meant for.
+func generatedSource(functions int) string {
+	var sb strings.Builder
+	for i := 0; i < functions; i++ {
+		fmt.Fprintf(&sb, "func f%d(a, b = %d) {\n", i, i)
+		sb.WriteString("\tlet total = 0\n")
+		sb.WriteString("\tfor (let i = 0; i < a; i = i + 1) {\n")
+		sb.WriteString("\t\tif (i == b or total > 100) total = total - i else total = total + i * 2\n")
+		sb.WriteString("\t}\n")
+		fmt.Fprintf(&sb, "\treturn record(\"f%d\", total, items: a.items(b, a.x))\n", i)
+		sb.WriteString("}\n")
+	}
+	return sb.String()
+}
+
+func BenchmarkParse(b *testing.B) {
+	benchmarkParse(b, func(p *Parser) interface{} {
+		nodes, err := p.Parse()
+		if err != nil {
+			b.Fatal(err)
+		}
+		return nodes
+	})
+}
+
+func BenchmarkParseCompact(b *testing.B) {
+	benchmarkParse(b, func(p *Parser) interface{} {
+		arena, err := p.ParseCompact()
+		if err != nil {
+			b.Fatal(err)
+		}
+		return arena
+	})
+}
+
+// benchmarkParse reports the time and allocations taken to parse a generated
+// program, along with how much memory the result holds on to once the tokens
+// are dropped.
+func benchmarkParse(b *testing.B, parse func(p *Parser) interface{}) {
+	source := generatedSource(1000)
+	tokens, err := tokenize.NewTokenizer(strings.NewReader(source)).Tokenize()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		parse(NewParser(&tokens))
+	}
+	b.StopTimer()
+
+	tokens = nil
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	tokens, _ = tokenize.NewTokenizer(strings.NewReader(source)).Tokenize()
+	result := parse(NewParser(&tokens))
+	tokens = nil
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc), "retained-B")
+	runtime.KeepAlive(result)
+}
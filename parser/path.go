@@ -0,0 +1,37 @@
+package parser
+
+import "brianhang.me/interpreter/tokenize"
+
+// PathEnclosing returns the path from a top-level node down to the innermost
+// node whose span encloses the source range from start to end, such as the
+// identifier under a cursor when start and end are the same. The range may
+// touch either end of a node's span. When it encloses no node, the result is
+// empty.
+func PathEnclosing(nodes []Node, start tokenize.Position, end tokenize.Position) []Node {
+	var path []Node
+	depth := 0
+	visit := func(n Node) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+		// A sibling ending where this node starts already enclosed the range.
+		if len(path) != depth {
+			return false
+		}
+		if isBefore(start, n.Pos()) || isBefore(n.End(), end) {
+			return false
+		}
+		path = append(path, n)
+		depth++
+		return true
+	}
+	for _, node := range nodes {
+		Inspect(node, visit)
+	}
+	return path
+}
+
+func isBefore(a tokenize.Position, b tokenize.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
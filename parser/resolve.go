@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"brianhang.me/interpreter/tokenize"
+)
+
+type binding struct {
+	declaration tokenize.IdentifierToken
+	isConst     bool
+}
+
+type resolver struct {
+	scopes []map[string]binding
+	err    error
+}
+
+// Resolve statically checks the variables used by a parsed program. Each
+// block, function, catch and for loop introduces a scope for the let and const
+// declarations inside of it, and every assignment must refer to a variable
+// that is declared and not constant in one of the enclosing scopes.
+func Resolve(nodes []Node) error {
+	r := &resolver{}
+	r.beginScope()
+	ApplyList(nodes, r.pre, r.post)
+	return r.err
+}
+
+func (r *resolver) pre(c *Cursor) bool {
+	if r.err != nil {
+		return false
+	}
+	switch n := c.Node().(type) {
+	case BlockNode, ForNode:
+		r.beginScope()
+	case ForInNode:
+		r.beginScope()
+		if len(n.Key.GetValue()) > 0 {
+			r.declare(n.Key, false)
+		}
+		r.declare(n.Value, false)
+	case FuncNode:
+		if len(n.Name.GetValue()) > 0 {
+			r.declare(n.Name, false)
+		}
+		r.beginScope()
+		for _, param := range n.Params {
+			r.declare(param.Name, false)
+		}
+	case ClassNode:
+		if len(n.Name.GetValue()) > 0 {
+			r.declare(n.Name, false)
+		}
+	case LetNode:
+		r.declare(n.Name, false)
+	case ConstNode:
+		r.declare(n.Name, true)
+	case MatchNode:
+		if !isExhaustive(n) {
+			r.err = &NonExhaustiveMatchError{match: n.Match}
+		}
+	case CatchNode:
+		r.beginScope()
+		r.declare(n.Name, false)
+	case MatchArmNode:
+		r.beginScope()
+		for _, name := range PatternBindings(n.Pattern) {
+			r.declare(name, false)
+		}
+	case DestructureNode:
+		for _, name := range PatternBindings(n.Pattern) {
+			r.assign(name)
+			if r.err != nil {
+				break
+			}
+		}
+	case AssignmentNode:
+		if _, isField := c.Parent().(ClassNode); !isField {
+			r.assign(n.LHS.(tokenize.IdentifierToken))
+		}
+	}
+	return r.err == nil
+}
+
+func (r *resolver) post(c *Cursor) bool {
+	switch c.Node().(type) {
+	case BlockNode, ForNode, ForInNode, FuncNode, CatchNode, MatchArmNode:
+		r.endScope()
+	}
+	return r.err == nil
+}
+
+func (r *resolver) beginScope() {
+	r.scopes = append(r.scopes, make(map[string]binding))
+}
+
+func (r *resolver) endScope() {
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+func (r *resolver) declare(name tokenize.IdentifierToken, isConst bool) {
+	scope := r.scopes[len(r.scopes)-1]
+	if previous, ok := scope[name.GetValue()]; ok {
+		r.err = &RedeclarationError{name: name, declaration: previous.declaration}
+		return
+	}
+	scope[name.GetValue()] = binding{declaration: name, isConst: isConst}
+}
+
+func (r *resolver) assign(name tokenize.IdentifierToken) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		binding, ok := r.scopes[i][name.GetValue()]
+		if !ok {
+			continue
+		}
+		if binding.isConst {
+			r.err = &ConstAssignmentError{name: name, declaration: binding.declaration}
+		}
+		return
+	}
+	r.err = &UndeclaredAssignmentError{name: name}
+}
+
+// Classes can always be extended, so a match that checks for class instances
+// can only be exhaustive with an unguarded arm that matches any value.
+func isExhaustive(match MatchNode) bool {
+	hasClassPattern := false
+	for _, arm := range match.Arms {
+		switch arm.Pattern.(type) {
+		case WildcardPatternNode, IdentifierPatternNode:
+			if arm.Guard == nil {
+				return true
+			}
+		case ClassPatternNode:
+			hasClassPattern = true
+		}
+	}
+	return !hasClassPattern
+}
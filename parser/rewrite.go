@@ -0,0 +1,467 @@
+package parser
+
+import "fmt"
+
+// Apply and Cursor are adapted from golang.org/x/tools/go/ast/astutil.
+
+// An ApplyFunc is called by Apply for each node. Returning false stops the
+// traversal as described in Apply.
+type ApplyFunc func(*Cursor) bool
+
+// Apply walks the tree under root, calling pre before and post after each
+// node's children, and returns the rewritten tree. If pre returns false the
+// node's children and post are skipped, and if post returns false the walk
+// stops. The tree passed in is left unchanged, and an ArenaNode in it is
+// visited as the node it rebuilds.
+func Apply(root Node, pre, post ApplyFunc) Node {
+	if root == nil {
+		return nil
+	}
+	a := &application{pre: pre, post: post}
+	return a.apply(nil, "", nil, root)
+}
+
+// ApplyList is like Apply for a list of top-level statements.
+func ApplyList(nodes []Node, pre, post ApplyFunc) []Node {
+	a := &application{pre: pre, post: post}
+	return a.applyList(nil, "", append([]Node(nil), nodes...))
+}
+
+// A Cursor is the node being visited by Apply, along with its parent.
+type Cursor struct {
+	parent  Node
+	name    string
+	iter    *iterator
+	node    Node
+	deleted bool
+}
+
+type iterator struct {
+	list  []Node
+	index int
+	step  int
+}
+
+func (c *Cursor) Node() Node {
+	return c.node
+}
+
+// Parent returns the current node's parent before any rewriting, or nil at
+// the root.
+func (c *Cursor) Parent() Node {
+	return c.parent
+}
+
+// Name returns the parent's field holding the current node, like "Children".
+func (c *Cursor) Name() string {
+	return c.name
+}
+
+// Index returns the current node's index in its parent's slice, or -1.
+func (c *Cursor) Index() int {
+	if c.iter != nil {
+		return c.iter.index
+	}
+	return -1
+}
+
+// Replace replaces the current node with n, which is not walked.
+func (c *Cursor) Replace(n Node) {
+	c.node = n
+}
+
+// Delete removes the current node from its slice. It panics outside a slice.
+func (c *Cursor) Delete() {
+	i := c.checkIndex("Delete")
+	c.iter.list = append(c.iter.list[:i], c.iter.list[i+1:]...)
+	c.iter.step--
+	c.deleted = true
+}
+
+// InsertAfter inserts n, which is not walked, after the current node in its
+// slice. It panics outside a slice.
+func (c *Cursor) InsertAfter(n Node) {
+	i := c.checkIndex("InsertAfter")
+	c.iter.list = insertNode(c.iter.list, i+1, n)
+	c.iter.step++
+}
+
+// InsertBefore inserts n, which is not walked, before the current node in its
+// slice. It panics outside a slice.
+func (c *Cursor) InsertBefore(n Node) {
+	i := c.checkIndex("InsertBefore")
+	c.iter.list = insertNode(c.iter.list, i, n)
+	c.iter.index++
+}
+
+func (c *Cursor) checkIndex(operation string) int {
+	i := c.Index()
+	if i < 0 {
+		panic(fmt.Sprintf("%s node not contained in slice", operation))
+	}
+	if c.deleted {
+		panic(fmt.Sprintf("%s called on a deleted node", operation))
+	}
+	return i
+}
+
+func insertNode(list []Node, i int, n Node) []Node {
+	list = append(list, nil)
+	copy(list[i+1:], list[i:])
+	list[i] = n
+	return list
+}
+
+type application struct {
+	pre     ApplyFunc
+	post    ApplyFunc
+	cursor  Cursor
+	stopped bool
+}
+
+func (a *application) apply(parent Node, name string, iter *iterator, n Node) Node {
+	if n == nil || a.stopped {
+		return n
+	}
+	if arena, ok := n.(ArenaNode); ok {
+		n = arena.Node()
+	}
+	saved := a.cursor
+	defer func() { a.cursor = saved }()
+	a.cursor = Cursor{parent: parent, name: name, iter: iter, node: n}
+
+	if a.pre != nil && !a.pre(&a.cursor) {
+		return a.result()
+	}
+	if a.cursor.deleted {
+		return nil
+	}
+	if a.cursor.node != nil {
+		a.cursor.node = a.walk(a.cursor.node)
+	}
+	if a.post != nil && !a.post(&a.cursor) {
+		a.stopped = true
+	}
+	return a.result()
+}
+
+func (a *application) result() Node {
+	c := &a.cursor
+	if c.iter != nil && !c.deleted {
+		c.iter.list[c.iter.index] = c.node
+	}
+	return c.node
+}
+
+func (a *application) applyList(parent Node, name string, list []Node) []Node {
+	iter := &iterator{list: list}
+	for iter.index < len(iter.list) {
+		iter.step = 1
+		a.apply(parent, name, iter, iter.list[iter.index])
+		iter.index += iter.step
+	}
+	return iter.list
+}
+
+func (a *application) walk(n Node) Node {
+	switch n := n.(type) {
+	case ConditionalNode:
+		parent := n
+		n.Condition = a.apply(parent, "Condition", nil, n.Condition)
+		n.TrueBody = a.apply(parent, "TrueBody", nil, n.TrueBody)
+		n.FalseBody = a.apply(parent, "FalseBody", nil, n.FalseBody)
+		return n
+	case WhileNode:
+		parent := n
+		n.Condition = a.apply(parent, "Condition", nil, n.Condition)
+		n.Body = a.apply(parent, "Body", nil, n.Body)
+		return n
+	case DoWhileNode:
+		parent := n
+		n.Body = a.apply(parent, "Body", nil, n.Body)
+		n.Condition = a.apply(parent, "Condition", nil, n.Condition)
+		return n
+	case ForNode:
+		parent := n
+		n.Init = a.apply(parent, "Init", nil, n.Init)
+		n.Condition = a.apply(parent, "Condition", nil, n.Condition)
+		n.Update = a.apply(parent, "Update", nil, n.Update)
+		n.Body = a.apply(parent, "Body", nil, n.Body)
+		return n
+	case ForInNode:
+		parent := n
+		n.Collection = a.apply(parent, "Collection", nil, n.Collection)
+		n.Body = a.apply(parent, "Body", nil, n.Body)
+		return n
+	case LabeledNode:
+		n.Body = a.apply(n, "Body", nil, n.Body)
+		return n
+	case BlockNode:
+		n.Children = a.applyStatements(n, "Children", n.Children)
+		return n
+	case AssignmentNode:
+		n.RHS = a.apply(n, "RHS", nil, n.RHS)
+		return n
+	case DestructureNode:
+		parent := n
+		n.Pattern = a.apply(parent, "Pattern", nil, n.Pattern)
+		n.Values = a.applyExpressions(parent, "Values", n.Values)
+		return n
+	case ArrayPatternNode:
+		n.Elements = a.applyPatterns(n, "Elements", n.Elements)
+		return n
+	case TuplePatternNode:
+		n.Elements = a.applyPatterns(n, "Elements", n.Elements)
+		return n
+	case ClassPatternNode:
+		fields, ok := a.apply(n, "Fields", nil, n.Fields).(MapPatternNode)
+		if !ok {
+			panic("Apply: ClassPatternNode.Fields must be a MapPatternNode")
+		}
+		n.Fields = fields
+		return n
+	case IdentifierPatternNode, MapPatternNode, LiteralPatternNode, WildcardPatternNode:
+		return n
+	case MatchNode:
+		parent := n
+		n.Value = a.apply(parent, "Value", nil, n.Value)
+		n.Arms = a.applyArms(parent, "Arms", n.Arms)
+		return n
+	case MatchArmNode:
+		parent := n
+		n.Pattern = a.apply(parent, "Pattern", nil, n.Pattern)
+		n.Guard = a.apply(parent, "Guard", nil, n.Guard)
+		n.Body = a.apply(parent, "Body", nil, n.Body)
+		return n
+	case SetNode:
+		parent := n
+		n.Object = a.apply(parent, "Object", nil, n.Object)
+		n.RHS = a.apply(parent, "RHS", nil, n.RHS)
+		return n
+	case CallNode:
+		parent := n
+		n.Function = a.apply(parent, "Function", nil, n.Function)
+		n.Args = a.applyArgs(parent, "Args", n.Args)
+		return n
+	case ArgNode:
+		n.Value = a.apply(n, "Value", nil, n.Value)
+		return n
+	case FuncNode:
+		parent := n
+		n.Params = a.applyParams(parent, "Params", n.Params)
+		n.Body = a.applyBlock(parent, "Body", n.Body)
+		return n
+	case ParamNode:
+		n.Default = a.apply(n, "Default", nil, n.Default)
+		return n
+	case ReturnNode:
+		n.Value = a.apply(n, "Value", nil, n.Value)
+		return n
+	case ThrowNode:
+		n.Value = a.apply(n, "Value", nil, n.Value)
+		return n
+	case TryNode:
+		parent := n
+		n.Body = a.applyBlock(parent, "Body", n.Body)
+		n.Catches = a.applyCatches(parent, "Catches", n.Catches)
+		n.FinallyBody = a.apply(parent, "FinallyBody", nil, n.FinallyBody)
+		return n
+	case CatchNode:
+		n.Body = a.applyBlock(n, "Body", n.Body)
+		return n
+	case LetNode:
+		n.Value = a.apply(n, "Value", nil, n.Value)
+		return n
+	case ConstNode:
+		n.Value = a.apply(n, "Value", nil, n.Value)
+		return n
+	case ClassNode:
+		n.Body = a.applyAssignments(n, "Body", n.Body)
+		return n
+	case LogicalExprNode:
+		parent := n
+		n.LHS = a.apply(parent, "LHS", nil, n.LHS)
+		n.RHS = a.apply(parent, "RHS", nil, n.RHS)
+		return n
+	case BinaryExprNode:
+		parent := n
+		n.LHS = a.apply(parent, "LHS", nil, n.LHS)
+		n.RHS = a.apply(parent, "RHS", nil, n.RHS)
+		return n
+	case UnaryExprNode:
+		n.Operand = a.apply(n, "Operand", nil, n.Operand)
+		return n
+	case LookupNode:
+		n.Value = a.apply(n, "Value", nil, n.Value)
+		return n
+	case GroupNode:
+		n.Expression = a.apply(n, "Expression", nil, n.Expression)
+		return n
+	case BreakNode, ContinueNode, ThisNode, SuperNode, LiteralNode:
+		return n
+	case ExtensionNode:
+		parent := n
+		return n.ApplyChildren(func(name string, child Node) Node {
+			return a.apply(parent, name, nil, child)
+		})
+	default:
+		panic(fmt.Sprintf("Apply: unexpected node type %T", n))
+	}
+}
+
+func (a *application) applyBlock(parent Node, name string, block BlockNode) BlockNode {
+	n := a.apply(parent, name, nil, block)
+	result, ok := n.(BlockNode)
+	if !ok {
+		panic(fmt.Sprintf("Apply: %T.%s must be a BlockNode, got %T", parent, name, n))
+	}
+	return result
+}
+
+func (a *application) applyStatements(parent Node, name string, statements []StatementNode) []StatementNode {
+	if statements == nil {
+		return nil
+	}
+	list := make([]Node, len(statements))
+	for i, statement := range statements {
+		list[i] = statement
+	}
+	list = a.applyList(parent, name, list)
+	result := make([]StatementNode, len(list))
+	for i, n := range list {
+		result[i] = n
+	}
+	return result
+}
+
+func (a *application) applyExpressions(parent Node, name string, expressions []ExpressionNode) []ExpressionNode {
+	if expressions == nil {
+		return nil
+	}
+	list := make([]Node, len(expressions))
+	for i, expression := range expressions {
+		list[i] = expression
+	}
+	list = a.applyList(parent, name, list)
+	result := make([]ExpressionNode, len(list))
+	for i, n := range list {
+		result[i] = n
+	}
+	return result
+}
+
+func (a *application) applyPatterns(parent Node, name string, patterns []PatternNode) []PatternNode {
+	if patterns == nil {
+		return nil
+	}
+	list := make([]Node, len(patterns))
+	for i, pattern := range patterns {
+		list[i] = pattern
+	}
+	list = a.applyList(parent, name, list)
+	result := make([]PatternNode, len(list))
+	for i, n := range list {
+		result[i] = n
+	}
+	return result
+}
+
+func (a *application) applyCatches(parent Node, name string, catches []CatchNode) []CatchNode {
+	if catches == nil {
+		return nil
+	}
+	list := make([]Node, len(catches))
+	for i, catch := range catches {
+		list[i] = catch
+	}
+	list = a.applyList(parent, name, list)
+	result := make([]CatchNode, len(list))
+	for i, n := range list {
+		catch, ok := n.(CatchNode)
+		if !ok {
+			panic(fmt.Sprintf("Apply: %T.%s must contain CatchNodes, got %T", parent, name, n))
+		}
+		result[i] = catch
+	}
+	return result
+}
+
+func (a *application) applyArms(parent Node, name string, arms []MatchArmNode) []MatchArmNode {
+	if arms == nil {
+		return nil
+	}
+	list := make([]Node, len(arms))
+	for i, arm := range arms {
+		list[i] = arm
+	}
+	list = a.applyList(parent, name, list)
+	result := make([]MatchArmNode, len(list))
+	for i, n := range list {
+		arm, ok := n.(MatchArmNode)
+		if !ok {
+			panic(fmt.Sprintf("Apply: %T.%s must contain MatchArmNodes, got %T", parent, name, n))
+		}
+		result[i] = arm
+	}
+	return result
+}
+
+func (a *application) applyArgs(parent Node, name string, args []ArgNode) []ArgNode {
+	if args == nil {
+		return nil
+	}
+	list := make([]Node, len(args))
+	for i, arg := range args {
+		list[i] = arg
+	}
+	list = a.applyList(parent, name, list)
+	result := make([]ArgNode, len(list))
+	for i, n := range list {
+		arg, ok := n.(ArgNode)
+		if !ok {
+			panic(fmt.Sprintf("Apply: %T.%s must contain ArgNodes, got %T", parent, name, n))
+		}
+		result[i] = arg
+	}
+	return result
+}
+
+func (a *application) applyParams(parent Node, name string, params []ParamNode) []ParamNode {
+	if params == nil {
+		return nil
+	}
+	list := make([]Node, len(params))
+	for i, param := range params {
+		list[i] = param
+	}
+	list = a.applyList(parent, name, list)
+	result := make([]ParamNode, len(list))
+	for i, n := range list {
+		param, ok := n.(ParamNode)
+		if !ok {
+			panic(fmt.Sprintf("Apply: %T.%s must contain ParamNodes, got %T", parent, name, n))
+		}
+		result[i] = param
+	}
+	return result
+}
+
+func (a *application) applyAssignments(parent Node, name string, assignments []AssignmentNode) []AssignmentNode {
+	if assignments == nil {
+		return nil
+	}
+	list := make([]Node, len(assignments))
+	for i, assignment := range assignments {
+		list[i] = assignment
+	}
+	list = a.applyList(parent, name, list)
+	result := make([]AssignmentNode, len(list))
+	for i, n := range list {
+		assignment, ok := n.(AssignmentNode)
+		if !ok {
+			panic(fmt.Sprintf("Apply: %T.%s must contain AssignmentNodes, got %T", parent, name, n))
+		}
+		result[i] = assignment
+	}
+	return result
+}
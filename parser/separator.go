@@ -0,0 +1,37 @@
+package parser
+
+import "brianhang.me/interpreter/tokenize"
+
+// Newlines don't end statements, so "x" followed by "(y)" on the next line is
+// a call. A statement at the top level or in a block may be followed by one
+// ';' to end it, as in "x; (y)". Two in a row are an error, and an 'else'
+// can't follow one.
+
+// statementSeparator consumes the optional ';' after a statement.
+func (p *Parser) statementSeparator() {
+	p.maybeMatch(tokenize.TokenSemicolon)
+}
+
+// returnEndTokenIDs are the tokens that end a return without a value. Besides
+// the end of a block and the optional ';' after a statement, these are the
+// 'else' of an if and the 'while' of a do loop whose body is the return. So a
+// 'return' followed by a while loop returns nothing, and the loop is the next
+// statement.
+var returnEndTokenIDs = []tokenize.TokenID{
+	tokenize.TokenRightCurly,
+	tokenize.TokenSemicolon,
+	tokenize.TokenElse,
+	tokenize.TokenWhile,
+}
+
+func (p *Parser) isReturnEnd() bool {
+	if p.peek() == nil {
+		return true
+	}
+	for _, tokenID := range returnEndTokenIDs {
+		if p.isTokenAtOffset(0, tokenID) {
+			return true
+		}
+	}
+	return false
+}
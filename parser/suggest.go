@@ -0,0 +1,64 @@
+package parser
+
+import "brianhang.me/interpreter/tokenize"
+
+// suggestKeyword returns the keyword among the expected tokens that name was
+// most likely a typo of, such as "while" for "whiel".
+func suggestKeyword(name string, expected []tokenize.TokenID) (tokenize.TokenID, bool) {
+	var suggestion tokenize.TokenID
+	best := -1
+	for _, id := range expected {
+		if !tokenize.IsKeyword(id) {
+			continue
+		}
+		keyword := id.String()
+		// Short keywords are only suggested for a single typo, since most
+		// short names are a couple of edits away from one.
+		maxDistance := 1
+		if len(keyword) > 4 {
+			maxDistance = 2
+		}
+		distance := editDistance(name, keyword)
+		if distance <= maxDistance && (best < 0 || distance < best) {
+			suggestion, best = id, distance
+		}
+	}
+	return suggestion, best >= 0
+}
+
+// editDistance returns the number of insertions, deletions, substitutions and
+// swaps of adjacent letters needed to turn a into b.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	rows := make([][]int, len(s)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(t)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(s)][len(t)]
+}
+
+func min(values ...int) int {
+	result := values[0]
+	for _, value := range values[1:] {
+		if value < result {
+			result = value
+		}
+	}
+	return result
+}
@@ -0,0 +1,188 @@
+package printer
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// The printer lays out source with a small document algebra in the style of
+// Wadler's "A prettier printer". A document is built out of text, line breaks,
+// nested indentation and groups. Each group is printed flat, with its line
+// breaks as spaces, when it fits in the rest of the line and broken otherwise.
+type doc interface{}
+
+type text string
+
+// line is a space when its group is flat and a newline otherwise. A soft line
+// is empty when flat, and a hard line is always a newline.
+type line struct {
+	soft bool
+	hard bool
+}
+
+// nest indents its lines when its group is broken, while indent always does.
+// A flat group can still hold hard lines, such as a function's body passed as
+// an argument, which then line up with the line the group started on.
+type nest struct {
+	doc doc
+}
+
+type indent struct {
+	doc doc
+}
+
+type group struct {
+	doc doc
+}
+
+type concat []doc
+
+// breakParent breaks the groups holding it, such as the list holding a line
+// comment, which would otherwise swallow the rest of the line. Blocks stop it,
+// since their lines are always broken.
+type breakParent struct{}
+
+// ifBreak prints broken when its group is broken and flat otherwise.
+type ifBreak struct {
+	broken string
+	flat   string
+}
+
+var (
+	spaceLine = line{}
+	softLine  = line{soft: true}
+	hardLine  = line{hard: true}
+)
+
+// Tabs are counted as this many columns when fitting lines to the width.
+const tabWidth = 4
+
+type frame struct {
+	indent int
+	flat   bool
+	doc    doc
+}
+
+func render(d doc, width int) string {
+	var sb strings.Builder
+	column := 0
+	stack := []frame{{doc: d}}
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch d := f.doc.(type) {
+		case text:
+			sb.WriteString(string(d))
+			column += utf8.RuneCountInString(string(d))
+		case concat:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, frame{f.indent, f.flat, d[i]})
+			}
+		case nest:
+			if f.flat {
+				stack = append(stack, frame{f.indent, f.flat, d.doc})
+			} else {
+				stack = append(stack, frame{f.indent + 1, f.flat, d.doc})
+			}
+		case indent:
+			stack = append(stack, frame{f.indent + 1, f.flat, d.doc})
+		case group:
+			flat := !hasBreak(d.doc) && (f.flat || fits(width-column, frame{f.indent, true, d.doc}, stack))
+			stack = append(stack, frame{f.indent, flat, d.doc})
+		case line:
+			if f.flat && !d.hard {
+				if !d.soft {
+					sb.WriteString(" ")
+					column++
+				}
+				continue
+			}
+			sb.WriteString("\n" + strings.Repeat("\t", f.indent))
+			column = f.indent * tabWidth
+		case ifBreak:
+			if f.flat {
+				sb.WriteString(d.flat)
+				column += len(d.flat)
+			} else {
+				sb.WriteString(d.broken)
+				column += len(d.broken)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// fits reports whether next, followed by the rest of the documents to print,
+// fits in the remaining width up to the next newline. Hard lines end the
+// measurement, so a group holding a block stays flat when its first line fits.
+func fits(remaining int, next frame, rest []frame) bool {
+	stack := []frame{next}
+	for remaining >= 0 {
+		if len(stack) == 0 {
+			if len(rest) == 0 {
+				return true
+			}
+			stack = append(stack, rest[len(rest)-1])
+			rest = rest[:len(rest)-1]
+		}
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch d := f.doc.(type) {
+		case text:
+			remaining -= utf8.RuneCountInString(string(d))
+		case concat:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, frame{f.indent, f.flat, d[i]})
+			}
+		case nest:
+			stack = append(stack, frame{f.indent, f.flat, d.doc})
+		case indent:
+			stack = append(stack, frame{f.indent, f.flat, d.doc})
+		case group:
+			stack = append(stack, frame{f.indent, f.flat, d.doc})
+		case line:
+			if d.hard || !f.flat {
+				return true
+			}
+			if !d.soft {
+				remaining--
+			}
+		case ifBreak:
+			if f.flat {
+				remaining -= len(d.flat)
+			} else {
+				remaining -= len(d.broken)
+			}
+		}
+	}
+	return false
+}
+
+func hasBreak(d doc) bool {
+	switch d := d.(type) {
+	case breakParent:
+		return true
+	case concat:
+		for _, child := range d {
+			if hasBreak(child) {
+				return true
+			}
+		}
+	case nest:
+		return hasBreak(d.doc)
+	case group:
+		return hasBreak(d.doc)
+	}
+	return false
+}
+
+func join(docs []doc, separator doc) concat {
+	joined := concat{}
+	for i, d := range docs {
+		if i > 0 {
+			joined = append(joined, separator)
+		}
+		joined = append(joined, d)
+	}
+	return joined
+}
@@ -0,0 +1,693 @@
+package printer
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"brianhang.me/interpreter/parser"
+	"brianhang.me/interpreter/tokenize"
+)
+
+// The precedence of each level of the grammar, from loosest to tightest.
+const (
+	precExpression = iota
+	precAssignment
+	precOr
+	precAnd
+	precEquality
+	precComparison
+	precTerm
+	precFactor
+	precUnary
+	precCall
+	precPrimary
+)
+
+var binaryPrecedence = map[tokenize.TokenID]int{
+	tokenize.TokenOr:           precOr,
+	tokenize.TokenAnd:          precAnd,
+	tokenize.TokenEqualEqual:   precEquality,
+	tokenize.TokenBangEqual:    precEquality,
+	tokenize.TokenGreater:      precComparison,
+	tokenize.TokenGreaterEqual: precComparison,
+	tokenize.TokenLess:         precComparison,
+	tokenize.TokenLessEqual:    precComparison,
+	tokenize.TokenPlus:         precTerm,
+	tokenize.TokenMinus:        precTerm,
+	tokenize.TokenStar:         precFactor,
+	tokenize.TokenSlash:        precFactor,
+}
+
+const DefaultWidth = 80
+
+var endOfFile = tokenize.Position{Line: math.MaxInt32}
+
+type Config struct {
+	// Width is the line width that argument and parameter lists are wrapped
+	// at, or DefaultWidth when it is zero.
+	Width int
+	// Comments are written next to the token they follow on the same line,
+	// or else before the token after them. A line comment breaks the list
+	// holding it, so that nothing is written after it on its line. The few
+	// comments with no such place, such as one before the parenthesis that
+	// closes a condition, go on their own line before the statement.
+	Comments []tokenize.CommentToken
+}
+
+type printer struct {
+	comments []tokenize.CommentToken
+	err      error
+}
+
+// UnsupportedNodeError is returned for a node that isn't part of the parser's
+// syntax tree, such as one from a lowered program.
+type UnsupportedNodeError struct {
+	Node parser.Node
+}
+
+func (e *UnsupportedNodeError) Error() string {
+	return fmt.Sprintf("Cannot print a node of type %T", e.Node)
+}
+
+// Fprint writes source code for nodes to w, with one statement per line and
+// only the parentheses needed to keep the same tree when it is parsed again.
+// A top level ArenaNode is printed as the node it rebuilds, while nodes that the parser
+// doesn't produce are reported with an UnsupportedNodeError.
+func Fprint(w io.Writer, nodes []parser.Node) error {
+	return (&Config{}).Fprint(w, nodes)
+}
+
+func (c *Config) Fprint(w io.Writer, nodes []parser.Node) error {
+	width := c.Width
+	if width == 0 {
+		width = DefaultWidth
+	}
+	nodes = append([]parser.Node(nil), nodes...)
+	for i, node := range nodes {
+		if arena, ok := node.(parser.ArenaNode); ok {
+			nodes[i] = arena.Node()
+		}
+	}
+	p := &printer{comments: c.Comments}
+	body := p.statements(nodes, endOfFile)
+	if p.err != nil {
+		return p.err
+	}
+	lines := strings.Split(render(body, width), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	source := strings.TrimLeft(strings.Join(lines, "\n"), "\n")
+	if source != "" {
+		source += "\n"
+	}
+	_, err := io.WriteString(w, source)
+	return err
+}
+
+func isBefore(a tokenize.Position, b tokenize.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+func (p *printer) commentsBefore(pos tokenize.Position) []tokenize.CommentToken {
+	i := 0
+	for i < len(p.comments) && isBefore(p.comments[i].GetPos(), pos) {
+		i++
+	}
+	comments := p.comments[:i]
+	p.comments = p.comments[i:]
+	return comments
+}
+
+func isLineComment(comment tokenize.CommentToken) bool {
+	return strings.HasPrefix(comment.GetValue(), "//")
+}
+
+// leading prints the comments before pos in front of the token there, with
+// each line comment on a line of its own.
+func (p *printer) leading(pos tokenize.Position) concat {
+	docs := concat{}
+	for _, comment := range p.commentsBefore(pos) {
+		if isLineComment(comment) {
+			docs = append(docs, text(comment.GetValue()), breakParent{}, hardLine)
+		} else {
+			docs = append(docs, text(comment.GetValue()+" "))
+		}
+	}
+	return docs
+}
+
+// trailing prints the comments before pos that start on line, after the token
+// that ends that line.
+func (p *printer) trailing(line int, pos tokenize.Position) concat {
+	docs := concat{}
+	for len(p.comments) > 0 && isBefore(p.comments[0].GetPos(), pos) && p.comments[0].GetLine() == line {
+		comment := p.comments[0]
+		p.comments = p.comments[1:]
+		docs = append(docs, text(" "+comment.GetValue()))
+		if isLineComment(comment) {
+			docs = append(docs, breakParent{})
+		}
+	}
+	return docs
+}
+
+func position(token tokenize.TokenHolder) tokenize.Position {
+	if token == nil {
+		return tokenize.Position{}
+	}
+	return token.GetPos()
+}
+
+// lines puts each node on its own line, along with the comments around them,
+// keeping single blank lines from the source. Comments left over before end
+// go after the last node.
+func (p *printer) lines(nodes []parser.Node, end tokenize.Position, item func(i int) doc) concat {
+	docs := concat{}
+	lastLine := 0
+	newline := func(line int) {
+		if lastLine > 0 && line > lastLine+1 {
+			docs = append(docs, hardLine)
+		}
+		docs = append(docs, hardLine)
+	}
+	ownLines := func(comments []tokenize.CommentToken) {
+		for _, comment := range comments {
+			newline(comment.GetLine())
+			docs = append(docs, text(comment.GetValue()))
+			lastLine = comment.GetEnd().Line
+		}
+	}
+	for i, node := range nodes {
+		ownLines(p.commentsBefore(node.Pos()))
+		// Printing the node takes the comments of the statements nested in
+		// it, so any left inside of it are within an expression.
+		printed := item(i)
+		ownLines(p.commentsBefore(node.End()))
+		newline(node.Pos().Line)
+		docs = append(docs, printed)
+		lastLine = node.End().Line
+		if len(p.comments) > 0 && lastLine > 0 && p.comments[0].GetLine() == lastLine &&
+			isBefore(p.comments[0].GetPos(), end) {
+			docs = append(docs, text(" "+p.comments[0].GetValue()))
+			p.comments = p.comments[1:]
+		}
+	}
+	ownLines(p.commentsBefore(end))
+	return docs
+}
+
+func (p *printer) statements(nodes []parser.Node, end tokenize.Position) concat {
+	return p.lines(nodes, end, func(i int) doc {
+		statement := p.statement(nodes[i], false)
+		if i+1 < len(nodes) && needsSemicolon(nodes[i], nodes[i+1]) {
+			return concat{statement, text(";")}
+		}
+		return statement
+	})
+}
+
+// Statements are not separated by newlines, so a statement needs a semicolon
+// when the next one could otherwise continue it.
+func needsSemicolon(node parser.Node, next parser.Node) bool {
+	if n, ok := node.(parser.ReturnNode); ok && n.Value == nil {
+		return true
+	}
+	return continuesStatement(next)
+}
+
+// continuesStatement reports whether the statement for node starts with a
+// parenthesis or a minus sign.
+func continuesStatement(node parser.Node) bool {
+	var operand parser.Node
+	var min int
+	switch n := parser.Unparen(node).(type) {
+	case parser.UnaryExprNode:
+		return n.Operator.GetID() == tokenize.TokenMinus
+	case parser.CallNode:
+		operand, min = n.Function, precCall
+	case parser.LookupNode:
+		operand, min = n.Value, precCall
+	case parser.SetNode:
+		operand, min = n.Object, precCall
+	case parser.BinaryExprNode:
+		operand, min = n.LHS, binaryPrecedence[n.Operator.GetID()]
+	case parser.LogicalExprNode:
+		operand, min = n.LHS, binaryPrecedence[n.Operator.GetID()]
+	default:
+		return false
+	}
+	return precedence(operand) < leftmostPrecedence(operand, min) || continuesStatement(operand)
+}
+
+// statement prints a statement. When beforeElse is set, the statement is
+// followed by an else, so a trailing conditional without an else of its own
+// is wrapped in parentheses to keep it from taking the else.
+func (p *printer) statement(node parser.Node, beforeElse bool) doc {
+	if node == nil {
+		return nil
+	}
+	if comments := p.leading(node.Pos()); len(comments) > 0 {
+		return concat{comments, p.statement(node, beforeElse)}
+	}
+	switch n := parser.Unparen(node).(type) {
+	case parser.ConditionalNode:
+		if beforeElse && n.FalseBody == nil {
+			return concat{text("("), p.conditional(n, false), text(")")}
+		}
+		return p.conditional(n, beforeElse)
+	case parser.WhileNode:
+		return concat{
+			text("while ("),
+			p.expr(n.Condition, precExpression),
+			text(") "),
+			p.statement(n.Body, beforeElse),
+		}
+	case parser.DoWhileNode:
+		return concat{
+			text("do "),
+			p.statement(n.Body, false),
+			text(" while ("),
+			p.expr(n.Condition, precExpression),
+			text(")"),
+		}
+	case parser.ForNode:
+		docs := concat{text("for (")}
+		if n.Init != nil {
+			docs = append(docs, p.statement(n.Init, false))
+		}
+		docs = append(docs, text(";"))
+		if n.Condition != nil {
+			docs = append(docs, text(" "), p.expr(n.Condition, precExpression))
+		}
+		docs = append(docs, text(";"))
+		if n.Update != nil {
+			docs = append(docs, text(" "), p.expr(n.Update, precExpression))
+		}
+		return append(docs, text(") "), p.statement(n.Body, beforeElse))
+	case parser.ForInNode:
+		docs := concat{text("for (")}
+		if n.Key.GetValue() != "" {
+			docs = append(docs, text(n.Key.GetValue()+", "))
+		}
+		return append(
+			docs,
+			text(n.Value.GetValue()+" in "),
+			p.expr(n.Collection, precExpression),
+			text(") "),
+			p.statement(n.Body, beforeElse),
+		)
+	case parser.BreakNode:
+		return jump("break", n.Label)
+	case parser.ContinueNode:
+		return jump("continue", n.Label)
+	case parser.LabeledNode:
+		return concat{text(n.Label.GetValue() + ": "), p.statement(n.Body, beforeElse)}
+	case parser.DestructureNode:
+		values := make([]doc, len(n.Values))
+		for i, value := range n.Values {
+			values[i] = p.expr(value, precExpression)
+		}
+		return concat{pattern(n.Pattern), text(" = "), join(values, text(", "))}
+	case parser.ReturnNode:
+		if n.Value == nil {
+			return text("return")
+		}
+		return concat{text("return "), p.expr(n.Value, precExpression)}
+	case parser.ThrowNode:
+		return concat{text("throw "), p.expr(n.Value, precExpression)}
+	case parser.TryNode:
+		return p.try(n)
+	case parser.LetNode:
+		return p.declaration("let", n.Name, n.Value)
+	case parser.ConstNode:
+		return p.declaration("const", n.Name, n.Value)
+	}
+	return p.expr(node, precExpression)
+}
+
+func (p *printer) conditional(n parser.ConditionalNode, beforeElse bool) doc {
+	docs := concat{
+		text("if ("),
+		p.expr(n.Condition, precExpression),
+		text(") "),
+		p.statement(n.TrueBody, n.FalseBody != nil),
+	}
+	if n.FalseBody != nil {
+		// Comments before the else stay after the true branch.
+		comments := p.trailing(n.TrueBody.End().Line, position(n.Else))
+		for _, comment := range p.commentsBefore(position(n.Else)) {
+			comments = append(comments, hardLine, text(comment.GetValue()))
+		}
+		if len(comments) > 0 {
+			docs = append(docs, comments, hardLine, text("else "))
+		} else {
+			docs = append(docs, text(" else "))
+		}
+		docs = append(docs, p.statement(n.FalseBody, beforeElse))
+	}
+	return docs
+}
+
+func jump(keyword string, label tokenize.IdentifierToken) doc {
+	if label.GetValue() != "" {
+		return text(keyword + " " + label.GetValue())
+	}
+	return text(keyword)
+}
+
+func (p *printer) declaration(keyword string, name tokenize.IdentifierToken, value parser.Node) doc {
+	if value == nil {
+		return text(keyword + " " + name.GetValue())
+	}
+	return concat{text(keyword + " " + name.GetValue() + " = "), p.expr(value, precExpression)}
+}
+
+func (p *printer) try(n parser.TryNode) doc {
+	docs := concat{text("try "), p.block(n.Body)}
+	for _, catch := range n.Catches {
+		docs = append(docs, text(" catch ("+catch.Name.GetValue()))
+		if catch.Colon != nil {
+			docs = append(docs, text(": "+catch.Class.GetValue()))
+		}
+		docs = append(docs, text(") "), p.block(catch.Body))
+	}
+	if n.FinallyBody != nil {
+		docs = append(docs, text(" finally "), p.statement(n.FinallyBody, false))
+	}
+	return docs
+}
+
+func (p *printer) block(n parser.BlockNode) doc {
+	children := make([]parser.Node, len(n.Children))
+	for i, child := range n.Children {
+		children[i] = child
+	}
+	body := p.statements(children, n.BodyEnd.GetPos())
+	if len(body) == 0 {
+		return text("{}")
+	}
+	return concat{text("{"), indent{body}, hardLine, text("}")}
+}
+
+// list prints items separated by commas, one per line with a trailing comma
+// when they don't fit on the rest of the line. A comment on the same line as
+// an item stays after it, and the comments before the closing token stay
+// after the last item.
+func (p *printer) list(open string, nodes []parser.Node, item func(i int) doc, close string, closeToken tokenize.TokenHolder) doc {
+	end := position(closeToken)
+	if len(nodes) == 0 {
+		docs := concat{text(open)}
+		for i, comment := range p.commentsBefore(end) {
+			if i > 0 {
+				docs = append(docs, text(" "))
+			}
+			docs = append(docs, text(comment.GetValue()))
+			if isLineComment(comment) {
+				docs = append(docs, hardLine)
+			}
+		}
+		return append(docs, text(close))
+	}
+	items := concat{softLine}
+	for i, node := range nodes {
+		items = append(items, p.leading(node.Pos()), item(i))
+		if i+1 < len(nodes) {
+			items = append(items, text(","), p.trailing(node.End().Line, nodes[i+1].Pos()), spaceLine)
+			continue
+		}
+		items = append(items, ifBreak{broken: ","}, p.trailing(node.End().Line, end))
+		for _, comment := range p.commentsBefore(end) {
+			items = append(items, hardLine, text(comment.GetValue()), breakParent{})
+		}
+	}
+	return group{concat{text(open), nest{items}, softLine, text(close)}}
+}
+
+func precedence(node parser.Node) int {
+	switch n := parser.Unparen(node).(type) {
+	case parser.AssignmentNode, parser.SetNode:
+		return precAssignment
+	case parser.BinaryExprNode:
+		return binaryPrecedence[n.Operator.GetID()]
+	case parser.LogicalExprNode:
+		return binaryPrecedence[n.Operator.GetID()]
+	case parser.UnaryExprNode:
+		return precUnary
+	case parser.CallNode, parser.LookupNode:
+		return precCall
+	case parser.FuncNode, parser.ClassNode, parser.MatchNode, parser.ThisNode, parser.SuperNode, parser.LiteralNode:
+		return precPrimary
+	}
+	return precExpression
+}
+
+// expr prints an expression where the grammar expects at least the given
+// precedence, wrapping it in parentheses if it binds more loosely. The
+// parentheses from the source are dropped, so only the ones that are needed
+// are printed.
+func (p *printer) expr(node parser.Node, min int) doc {
+	if node == nil {
+		return nil
+	}
+	if comments := p.leading(node.Pos()); len(comments) > 0 {
+		return concat{comments, p.expr(node, min)}
+	}
+	node = parser.Unparen(node)
+	if precedence(node) < min {
+		return concat{text("("), p.expression(node), text(")")}
+	}
+	return p.expression(node)
+}
+
+// leftmostPrecedence returns the precedence that the first operand of an
+// expression needs. Statements that start with func or class end after the
+// function or class, and a number followed by a dot would be read as a
+// fraction, so these need parentheses too.
+func leftmostPrecedence(node parser.Node, min int) int {
+	switch n := parser.Unparen(node).(type) {
+	case parser.FuncNode, parser.ClassNode:
+		return precPrimary + 1
+	case parser.LiteralNode:
+		if n.Value.GetID() == tokenize.TokenNumber && min == precCall {
+			return precPrimary + 1
+		}
+	}
+	return min
+}
+
+func (p *printer) leftmost(node parser.Node, min int) doc {
+	return p.expr(node, leftmostPrecedence(node, min))
+}
+
+func (p *printer) expression(node parser.Node) doc {
+	switch n := node.(type) {
+	case parser.BlockNode:
+		return p.block(n)
+	case parser.ConditionalNode:
+		return p.conditional(n, false)
+	case parser.AssignmentNode:
+		return concat{text(tokenText(n.LHS) + " " + assignmentOperator(n.Equal) + " "), p.expr(n.RHS, precAssignment)}
+	case parser.SetNode:
+		return concat{
+			p.leftmost(n.Object, precCall),
+			text("." + n.Key.GetValue() + " " + assignmentOperator(n.Equal) + " "),
+			p.expr(n.RHS, precAssignment),
+		}
+	case parser.BinaryExprNode:
+		return p.binary(n.LHS, n.Operator, n.RHS)
+	case parser.LogicalExprNode:
+		return p.binary(n.LHS, n.Operator, n.RHS)
+	case parser.UnaryExprNode:
+		return concat{text(n.Operator.GetID().String()), p.expr(n.Operand, precUnary)}
+	case parser.CallNode:
+		function := p.leftmost(n.Function, precCall)
+		args := make([]parser.Node, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = arg
+		}
+		return concat{function, p.list("(", args, func(i int) doc {
+			arg := n.Args[i]
+			if arg.Colon != nil {
+				return concat{text(arg.Name.GetValue() + ": "), p.expr(arg.Value, precExpression)}
+			}
+			return p.expr(arg.Value, precExpression)
+		}, ")", n.RightParen)}
+	case parser.LookupNode:
+		return concat{p.leftmost(n.Value, precCall), text("." + n.Key.GetValue())}
+	case parser.FuncNode:
+		return p.function(n)
+	case parser.ClassNode:
+		return p.class(n)
+	case parser.MatchNode:
+		return p.match(n)
+	case parser.ThisNode:
+		return text("this")
+	case parser.SuperNode:
+		return text("super." + n.Method.GetValue())
+	case parser.LiteralNode:
+		return text(tokenText(n.Value))
+	case parser.WhileNode, parser.DoWhileNode, parser.ForNode, parser.ForInNode, parser.BreakNode,
+		parser.ContinueNode, parser.LabeledNode, parser.DestructureNode, parser.ReturnNode,
+		parser.ThrowNode, parser.TryNode, parser.LetNode, parser.ConstNode:
+		return p.statement(node, false)
+	}
+	if p.err == nil {
+		p.err = &UnsupportedNodeError{Node: node}
+	}
+	return text("")
+}
+
+func (p *printer) binary(lhs parser.Node, operator tokenize.TokenHolder, rhs parser.Node) doc {
+	prec := binaryPrecedence[operator.GetID()]
+	return concat{
+		p.leftmost(lhs, prec),
+		text(" " + operator.GetID().String() + " "),
+		p.expr(rhs, prec+1),
+	}
+}
+
+func (p *printer) function(n parser.FuncNode) doc {
+	docs := concat{text("func")}
+	if n.Name.GetValue() != "" {
+		docs = append(docs, text(" "+n.Name.GetValue()))
+	}
+	params := make([]parser.Node, len(n.Params))
+	for i, param := range n.Params {
+		params[i] = param
+	}
+	return append(docs, p.list("(", params, func(i int) doc {
+		param := n.Params[i]
+		switch {
+		case param.Ellipsis != nil:
+			return text("..." + param.Name.GetValue())
+		case param.Default != nil:
+			return concat{text(param.Name.GetValue() + " = "), p.expr(param.Default, precExpression)}
+		}
+		return text(param.Name.GetValue())
+	}, ")", n.RightParen), text(" "), p.block(n.Body))
+}
+
+func (p *printer) class(n parser.ClassNode) doc {
+	docs := concat{text("class")}
+	if n.Name.GetValue() != "" {
+		docs = append(docs, text(" "+n.Name.GetValue()))
+	}
+	if n.Extends != nil {
+		docs = append(docs, text(" < "+n.ParentClass.GetValue()))
+	}
+	fields := make([]parser.Node, len(n.Body))
+	for i, field := range n.Body {
+		fields[i] = field
+	}
+	body := p.lines(fields, position(n.BodyEnd), func(i int) doc {
+		field := n.Body[i]
+		if function, ok := field.RHS.(parser.FuncNode); ok {
+			return concat{text(tokenText(field.LHS) + " = "), p.function(function)}
+		}
+		return concat{text(tokenText(field.LHS) + " = "), p.expr(field.RHS, precOr)}
+	})
+	if len(body) == 0 {
+		return append(docs, text(" {}"))
+	}
+	return append(docs, text(" {"), indent{body}, hardLine, text("}"))
+}
+
+func (p *printer) match(n parser.MatchNode) doc {
+	docs := concat{text("match ("), p.expr(n.Value, precExpression), text(") ")}
+	arms := make([]parser.Node, len(n.Arms))
+	for i, arm := range n.Arms {
+		arms[i] = arm
+	}
+	body := p.lines(arms, position(n.RightCurly), func(i int) doc {
+		arm := n.Arms[i]
+		docs := concat{pattern(arm.Pattern)}
+		if arm.Guard != nil {
+			docs = append(docs, text(" if "), p.expr(arm.Guard, precExpression))
+		}
+		return append(docs, text(" => "), p.expr(arm.Body, precExpression), text(","))
+	})
+	if len(body) == 0 {
+		return append(docs, text("{}"))
+	}
+	return append(docs, text("{"), indent{body}, hardLine, text("}"))
+}
+
+func pattern(node parser.Node) doc {
+	switch n := node.(type) {
+	case parser.IdentifierPatternNode:
+		return text(n.Name.GetValue())
+	case parser.WildcardPatternNode:
+		return text("_")
+	case parser.LiteralPatternNode:
+		if n.Minus != nil {
+			return text("-" + tokenText(n.Value))
+		}
+		return text(tokenText(n.Value))
+	case parser.ArrayPatternNode:
+		return concat{text("["), patterns(n.Elements), text("]")}
+	case parser.TuplePatternNode:
+		return patterns(n.Elements)
+	case parser.MapPatternNode:
+		return mapPattern(n)
+	case parser.ClassPatternNode:
+		return concat{text(n.Class.GetValue() + " "), mapPattern(n.Fields)}
+	}
+	return nil
+}
+
+func patterns(elements []parser.PatternNode) doc {
+	docs := make([]doc, len(elements))
+	for i, element := range elements {
+		docs[i] = pattern(element)
+	}
+	return join(docs, text(", "))
+}
+
+func mapPattern(n parser.MapPatternNode) doc {
+	keys := make([]string, len(n.Keys))
+	for i, key := range n.Keys {
+		keys[i] = key.GetValue()
+	}
+	return text("{" + strings.Join(keys, ", ") + "}")
+}
+
+func tokenText(token tokenize.TokenHolder) string {
+	switch token := token.(type) {
+	case tokenize.StringToken:
+		return quote(token.GetValue())
+	case tokenize.NumberToken:
+		return strconv.FormatFloat(token.GetValue(), 'f', -1, 64)
+	case tokenize.IdentifierToken:
+		if token.GetID() == tokenize.TokenIdentifier {
+			return token.GetValue()
+		}
+	}
+	return token.GetID().String()
+}
+
+var escapes = strings.NewReplacer(
+	"\\", "\\\\",
+	"\"", "\\\"",
+	"\n", "\\n",
+	"\r", "\\r",
+	"\t", "\\t",
+	"\b", "\\b",
+	"\f", "\\f",
+)
+
+func quote(value string) string {
+	return "\"" + escapes.Replace(value) + "\""
+}
+
+// assignmentOperator returns = or the compound operator of an assignment, so
+// that nodes built without an Equal token still print.
+func assignmentOperator(equal tokenize.TokenHolder) string {
+	if _, ok := parser.CompoundOperator(equal); ok {
+		return equal.GetID().String()
+	}
+	return "="
+}
@@ -0,0 +1,147 @@
+package printer
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"brianhang.me/interpreter/lower"
+	"brianhang.me/interpreter/parser"
+	"brianhang.me/interpreter/tokenize"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFprint(t *testing.T) {
+	cases := []struct {
+		source   string
+		expected string
+	}{
+		{"x = (1 + 2) * 3 - (4 - 5)", "x = (1 + 2) * 3 - (4 - 5)\n"},
+		{"y = ((a - b) - c) / -(d)", "y = (a - b - c) / -d\n"},
+		{"z = (a or b) and !(c == d)", "z = (a or b) and !(c == d)\n"},
+		{"a = b = (c = d)", "a = b = c = d\n"},
+		{"o.k = (if (a) b else c) + (1).x", "o.k = (if (a) b else c) + (1).x\n"},
+		{"(func() { return })()", "(func() {\n\treturn\n})()\n"},
+		{"x; (a + b).c; -1", "x;\n(a + b).c;\n-1\n"},
+		{
+			"class Foo < Bar { a = 1 f = func(x, y = 2, ...z) { return; g(x, y: \"s\\n\") } }",
+			"class Foo < Bar {\n\ta = 1\n\tf = func(x, y = 2, ...z) {\n\t\treturn;\n\t\tg(x, y: \"s\\n\")\n\t}\n}\n",
+		},
+		{
+			"m = match (v) { 0 => \"zero\", Point {x} if x > 0 => x, [_, n] => n, _ => nil }",
+			"m = match (v) {\n\t0 => \"zero\",\n\tPoint {x} if x > 0 => x,\n\t[_, n] => n,\n\t_ => nil,\n}\n",
+		},
+	}
+	for _, test := range cases {
+		var sb strings.Builder
+		err := Fprint(&sb, parse(t, test.source))
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, sb.String())
+	}
+}
+
+func TestFprintDanglingElse(t *testing.T) {
+	// Unwrapping the block leaves a tree that can't be written without
+	// parentheses, since the else would otherwise go to the inner if.
+	nodes := parse(t, "if (a) { while (b) if (c) d } else e")
+	nodes = parser.ApplyList(nodes, nil, func(c *parser.Cursor) bool {
+		if block, ok := c.Node().(parser.BlockNode); ok {
+			c.Replace(block.Children[0])
+		}
+		return true
+	})
+	var sb strings.Builder
+	assert.NoError(t, Fprint(&sb, nodes))
+	assert.Equal(t, "if (a) while (b) (if (c) d) else e\n", sb.String())
+	assert.Equal(t, structure(t, nodes), structure(t, parse(t, sb.String())))
+}
+
+func TestFprintUnsupported(t *testing.T) {
+	var sb strings.Builder
+	err := Fprint(&sb, lower.Lower(parse(t, "x = a and b")))
+	assert.IsType(t, &UnsupportedNodeError{}, err)
+	assert.EqualError(t, err, "Cannot print a node of type lower.CondNode")
+	assert.Empty(t, sb.String())
+
+	sb.Reset()
+	arena := parser.Compact(parse(t, "x = (1 + 2) * 3"))
+	assert.NoError(t, Fprint(&sb, []parser.Node{arena.Root(0)}))
+	assert.Equal(t, "x = (1 + 2) * 3\n", sb.String())
+}
+
+func TestFprintRoundTrip(t *testing.T) {
+	sources := []string{
+		"x = -1 + 2 * 3 y = !(x == \"a\\\"b\\\\\" or x != nil and true) z = .5",
+		"if (a) b else if (c) { d } else e if (a) if (b) c else d",
+		"class Foo < Bar { init = func(a, b = 0, ...rest) { super.init(a, b: 1) return this.x } }",
+		"func f() { return } f() (g)() -f",
+		"outer: for (let i = 0; ; i = i + 1) { for (k, v in m) { continue outer } break }",
+		"for (;;) { } for (x in xs) break",
+		"do { a.b = c } while (false) do return while (x)",
+		"let a const b = 2 [a, {c}] = d, e a, b = b, a {x, y} = p",
+		"y = match (x) { 0 => \"\", Point {x} if x > 0 => x, [_, [n, 1]] => n, _ => nil }",
+		"m = match (x) { -1 => a, [-2.5, 0] => b, _ => c }",
+		"try { throw e } catch (e: Err) { } catch (e) { f(e) } finally { }",
+		"x = ({ }) y = (if (a) b) z = class { } w = func() { }",
+		"a.b.c = (d.e = f)() (class { x = 1 }).x g((a = 1), 2) h = (a = 1) + 2",
+		"func named() { } (func() { })()",
+		"a - (b - c) + (d + e) a / (b * c) (a < b) == (c > d) !!a - -b",
+		"x += 1 a.b -= c *= 2 x /= -y",
+	}
+	for _, source := range sources {
+		nodes := parse(t, source)
+		var sb strings.Builder
+		if !assert.NoError(t, Fprint(&sb, nodes)) {
+			continue
+		}
+		printed := parse(t, sb.String())
+		assert.Equal(t, structure(t, nodes), structure(t, printed), "Printed \"%s\" as:\n%s", source, sb.String())
+	}
+}
+
+func parse(t *testing.T, source string) []parser.Node {
+	tokenizer := tokenize.NewTokenizer(strings.NewReader(source))
+	tokens, err := tokenizer.Tokenize()
+	if err != nil {
+		t.Fatalf("Failed to tokenize \"%s\": %s", source, err)
+	}
+	nodes, err := parser.NewParser(&tokens).Parse()
+	if err != nil {
+		t.Fatalf("Failed to parse \"%s\": %s", source, err)
+	}
+	return nodes
+}
+
+// structure returns the JSON form of nodes without any positions or
+// parentheses, so trees parsed from differently laid out source can be
+// compared.
+func structure(t *testing.T, nodes []parser.Node) interface{} {
+	data, err := parser.MarshalJSON(nodes)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %s", err)
+	}
+	var tree interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		t.Fatalf("Failed to unmarshal: %s", err)
+	}
+	return stripPositions(tree)
+}
+
+func stripPositions(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if value["kind"] == "Group" {
+			return stripPositions(value["Expression"])
+		}
+		delete(value, "pos")
+		delete(value, "end")
+		for key, child := range value {
+			value[key] = stripPositions(child)
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = stripPositions(child)
+		}
+	}
+	return value
+}
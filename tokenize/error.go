@@ -1,6 +1,20 @@
 package tokenize
 
-import "fmt"
+import (
+	"fmt"
+
+	"brianhang.me/interpreter/diagnostic"
+)
+
+// The codes of the diagnostics for tokenizer errors.
+const (
+	CodeUnexpectedCharacter = "E101"
+	CodeUnterminatedString  = "E102"
+	CodeUnterminatedComment = "E103"
+	CodeIncompleteFraction  = "E104"
+	CodeInputTooLarge       = "E105"
+	CodeTooManyTokens       = "E106"
+)
 
 type UnexpectedCharacterError struct {
 	character rune
@@ -17,6 +31,19 @@ func (e *UnexpectedCharacterError) Error() string {
 	)
 }
 
+func (e *UnexpectedCharacterError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeUnexpectedCharacter,
+		Message: e.Error(),
+		Span:    charSpan(e.line, e.column),
+		Label:   "unexpected character",
+	}
+}
+
+func (e *UnexpectedCharacterError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
 type UnterminatedStringError struct {
 	delimiter rune
 	line      int
@@ -32,8 +59,111 @@ func (e *UnterminatedStringError) Error() string {
 	)
 }
 
+func (e *UnterminatedStringError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeUnterminatedString,
+		Message: e.Error(),
+		Span:    charSpan(e.line, e.column),
+		Label:   "string starts here",
+	}
+}
+
+func (e *UnterminatedStringError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type UnterminatedCommentError struct {
+	line   int
+	column int
+}
+
+func (e *UnterminatedCommentError) Error() string {
+	return fmt.Sprintf(
+		"Expected a closing */ for comment starting on line %d at column %d",
+		e.line,
+		e.column,
+	)
+}
+
+func (e *UnterminatedCommentError) Diagnostic() diagnostic.Diagnostic {
+	span := diagnostic.Span{
+		Start: Position{Line: e.line, Column: e.column},
+		End:   Position{Line: e.line, Column: e.column + 2},
+	}
+	return diagnostic.Diagnostic{
+		Code:    CodeUnterminatedComment,
+		Message: e.Error(),
+		Span:    span,
+		Label:   "comment starts here",
+	}
+}
+
+func (e *UnterminatedCommentError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
 type IncompleteFractionError struct{}
 
 func (e *IncompleteFractionError) Error() string {
 	return "Attempted to parse a number as a fraction, but there were no digits after the dot"
 }
+
+func (e *IncompleteFractionError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{Code: CodeIncompleteFraction, Message: e.Error()}
+}
+
+func (e *IncompleteFractionError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type InputTooLargeError struct {
+	limit int
+}
+
+func (e *InputTooLargeError) Error() string {
+	return fmt.Sprintf("Input is larger than the limit of %d bytes", e.limit)
+}
+
+func (e *InputTooLargeError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{Code: CodeInputTooLarge, Message: e.Error()}
+}
+
+func (e *InputTooLargeError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+type TooManyTokensError struct {
+	limit  int
+	line   int
+	column int
+}
+
+func (e *TooManyTokensError) Error() string {
+	return fmt.Sprintf(
+		"Input has more than the limit of %d tokens, reached on line %d at column %d",
+		e.limit,
+		e.line,
+		e.column,
+	)
+}
+
+func (e *TooManyTokensError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:    CodeTooManyTokens,
+		Message: e.Error(),
+		Span:    charSpan(e.line, e.column),
+		Label:   "limit reached here",
+	}
+}
+
+func (e *TooManyTokensError) As(target interface{}) bool {
+	return diagnostic.As(e, target)
+}
+
+// charSpan returns the span of the character at the given line and column.
+func charSpan(line, column int) diagnostic.Span {
+	return diagnostic.Span{
+		Start: Position{Line: line, Column: column},
+		End:   Position{Line: line, Column: column + 1},
+	}
+}
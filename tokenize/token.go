@@ -3,6 +3,9 @@ package tokenize
 import (
 	"fmt"
 	"strconv"
+	"strings"
+
+	"brianhang.me/interpreter/diagnostic"
 )
 
 type TokenID int
@@ -14,19 +17,28 @@ const (
 	TokenRightParen
 	TokenLeftCurly
 	TokenRightCurly
+	TokenLeftBracket
+	TokenRightBracket
 
 	TokenComma
+	TokenColon
 	TokenDot
+	TokenEllipsis
 	TokenMinus
+	TokenMinusEqual
 	TokenPlus
+	TokenPlusEqual
 	TokenStar
+	TokenStarEqual
 	TokenSlash
+	TokenSlashEqual
 	TokenSemicolon
 
 	TokenBang
 	TokenBangEqual
 	TokenEqual
 	TokenEqualEqual
+	TokenArrow
 	TokenGreater
 	TokenGreaterEqual
 	TokenLess
@@ -35,6 +47,7 @@ const (
 	TokenIdentifier
 	TokenString
 	TokenNumber
+	TokenComment
 	TokenTrue
 	TokenFalse
 	TokenNil
@@ -43,12 +56,25 @@ const (
 	TokenOr
 	TokenIf
 	TokenElse
+	TokenMatch
 	TokenFor
+	TokenIn
 	TokenWhile
+	TokenDo
+	TokenBreak
+	TokenContinue
 
 	TokenFunc
 	TokenReturn
 
+	TokenThrow
+	TokenTry
+	TokenCatch
+	TokenFinally
+
+	TokenLet
+	TokenConst
+
 	TokenClass
 	TokenSuper
 	TokenThis
@@ -61,18 +87,28 @@ var tokenToString = map[TokenID]string{
 	TokenLeftCurly:  "{",
 	TokenRightCurly: "}",
 
-	TokenComma:     ",",
-	TokenDot:       ".",
-	TokenMinus:     "-",
-	TokenPlus:      "+",
-	TokenStar:      "*",
-	TokenSlash:     "/",
-	TokenSemicolon: ";",
+	TokenLeftBracket:  "[",
+	TokenRightBracket: "]",
+
+	TokenComma:      ",",
+	TokenColon:      ":",
+	TokenDot:        ".",
+	TokenEllipsis:   "...",
+	TokenMinus:      "-",
+	TokenMinusEqual: "-=",
+	TokenPlus:       "+",
+	TokenPlusEqual:  "+=",
+	TokenStar:       "*",
+	TokenStarEqual:  "*=",
+	TokenSlash:      "/",
+	TokenSlashEqual: "/=",
+	TokenSemicolon:  ";",
 
 	TokenBang:         "!",
 	TokenBangEqual:    "!=",
 	TokenEqual:        "=",
 	TokenEqualEqual:   "==",
+	TokenArrow:        "=>",
 	TokenGreater:      ">",
 	TokenGreaterEqual: ">=",
 	TokenLess:         "<",
@@ -81,6 +117,7 @@ var tokenToString = map[TokenID]string{
 	TokenIdentifier: "identifier",
 	TokenString:     "string",
 	TokenNumber:     "number",
+	TokenComment:    "comment",
 	TokenTrue:       "true",
 	TokenFalse:      "false",
 	TokenNil:        "nil",
@@ -89,12 +126,26 @@ var tokenToString = map[TokenID]string{
 	TokenOr:    "or",
 	TokenIf:    "if",
 	TokenElse:  "else",
+	TokenMatch: "match",
 	TokenFor:   "for",
+	TokenIn:    "in",
 	TokenWhile: "while",
 
+	TokenDo:       "do",
+	TokenBreak:    "break",
+	TokenContinue: "continue",
+
 	TokenFunc:   "func",
 	TokenReturn: "return",
 
+	TokenThrow:   "throw",
+	TokenTry:     "try",
+	TokenCatch:   "catch",
+	TokenFinally: "finally",
+
+	TokenLet:   "let",
+	TokenConst: "const",
+
 	TokenClass: "class",
 	TokenSuper: "super",
 	TokenThis:  "this",
@@ -104,19 +155,56 @@ func (id TokenID) String() string {
 	return tokenToString[id]
 }
 
+var stringToToken = func() map[string]TokenID {
+	ids := make(map[string]TokenID, len(tokenToString))
+	for id, name := range tokenToString {
+		ids[name] = id
+	}
+	return ids
+}()
+
+// LookupTokenID returns the token whose String() is the given name.
+func LookupTokenID(name string) (TokenID, bool) {
+	id, ok := stringToToken[name]
+	return id, ok
+}
+
+func IsKeyword(id TokenID) bool {
+	_, ok := keywordTokenTypes[id.String()]
+	return ok
+}
+
+// Position is shared with the diagnostic package, so that diagnostics can
+// point at tokens.
+type Position = diagnostic.Position
+
 type TokenHolder interface {
 	GetToken() Token
 	GetID() TokenID
 	GetLine() int
 	GetColumn() int
+	GetPos() Position
+	GetEnd() Position
 	String() string
 }
 
 type Token struct {
 	TokenHolder
-	id     TokenID
-	line   int
-	column int
+	id        TokenID
+	line      int
+	column    int
+	endLine   int
+	endColumn int
+}
+
+func NewToken(id TokenID, pos Position, end Position) Token {
+	return Token{
+		id:        id,
+		line:      pos.Line,
+		column:    pos.Column,
+		endLine:   end.Line,
+		endColumn: end.Column,
+	}
 }
 
 func (t Token) GetToken() Token {
@@ -132,6 +220,12 @@ func (t Token) GetLine() int {
 func (t Token) GetColumn() int {
 	return t.column
 }
+func (t Token) GetPos() Position {
+	return Position{Line: t.line, Column: t.column}
+}
+func (t Token) GetEnd() Position {
+	return Position{Line: t.endLine, Column: t.endColumn}
+}
 func (t Token) String() string {
 	return tokenToString[t.id]
 }
@@ -141,6 +235,10 @@ type StringToken struct {
 	value string
 }
 
+func NewStringToken(value string, pos Position, end Position) StringToken {
+	return StringToken{Token: NewToken(TokenString, pos, end), value: value}
+}
+
 func (t StringToken) GetToken() Token {
 	return t.Token
 }
@@ -153,6 +251,15 @@ func (t StringToken) GetLine() int {
 func (t StringToken) GetColumn() int {
 	return t.column
 }
+func (t StringToken) GetPos() Position {
+	return Position{Line: t.line, Column: t.column}
+}
+func (t StringToken) GetEnd() Position {
+	return Position{Line: t.endLine, Column: t.endColumn}
+}
+func (t StringToken) GetValue() string {
+	return t.value
+}
 func (t StringToken) String() string {
 	return fmt.Sprintf("\"%s\"", t.value)
 }
@@ -162,6 +269,10 @@ type NumberToken struct {
 	value float64
 }
 
+func NewNumberToken(value float64, pos Position, end Position) NumberToken {
+	return NumberToken{Token: NewToken(TokenNumber, pos, end), value: value}
+}
+
 func (t NumberToken) GetToken() Token {
 	return t.Token
 }
@@ -174,15 +285,77 @@ func (t NumberToken) GetLine() int {
 func (t NumberToken) GetColumn() int {
 	return t.column
 }
+func (t NumberToken) GetPos() Position {
+	return Position{Line: t.line, Column: t.column}
+}
+func (t NumberToken) GetEnd() Position {
+	return Position{Line: t.endLine, Column: t.endColumn}
+}
+func (t NumberToken) GetValue() float64 {
+	return t.value
+}
 func (t NumberToken) String() string {
 	return strconv.FormatFloat(t.value, 'f', -1, 64)
 }
 
+// CommentToken holds a comment, including the // or /* */ around it. Comments
+// are not part of the tokens returned by Tokenize and are kept separately for
+// tools that need them, such as the formatter.
+type CommentToken struct {
+	Token
+	value string
+}
+
+// NewCommentToken creates a comment, where value includes its delimiters.
+func NewCommentToken(value string, pos Position, end Position) CommentToken {
+	return CommentToken{Token: NewToken(TokenComment, pos, end), value: value}
+}
+
+func (t CommentToken) GetToken() Token {
+	return t.Token
+}
+func (t CommentToken) GetID() TokenID {
+	return t.id
+}
+func (t CommentToken) GetLine() int {
+	return t.line
+}
+func (t CommentToken) GetColumn() int {
+	return t.column
+}
+func (t CommentToken) GetPos() Position {
+	return Position{Line: t.line, Column: t.column}
+}
+func (t CommentToken) GetEnd() Position {
+	return Position{Line: t.endLine, Column: t.endColumn}
+}
+func (t CommentToken) GetValue() string {
+	return t.value
+}
+func (t CommentToken) String() string {
+	return t.value
+}
+
+// IsDoc reports whether the comment documents the declaration after it, which
+// is a /// line comment or a /** */ block comment.
+func (t CommentToken) IsDoc() bool {
+	if strings.HasPrefix(t.value, "///") {
+		return !strings.HasPrefix(t.value, "////")
+	}
+	return strings.HasPrefix(t.value, "/**") && !strings.HasPrefix(t.value, "/***") && t.value != "/**/"
+}
+
 type IdentifierToken struct {
 	Token
 	value string
 }
 
+// NewIdentifierToken creates an identifier, or a keyword when id is not
+// TokenIdentifier, in which case the value should be empty.
+func NewIdentifierToken(id TokenID, value string, pos Position, end Position) IdentifierToken {
+	return IdentifierToken{Token: NewToken(id, pos, end), value: value}
+}
+
 func (t IdentifierToken) GetToken() Token {
 	return t.Token
 }
@@ -195,6 +368,12 @@ func (t IdentifierToken) GetLine() int {
 func (t IdentifierToken) GetColumn() int {
 	return t.column
 }
+func (t IdentifierToken) GetPos() Position {
+	return Position{Line: t.line, Column: t.column}
+}
+func (t IdentifierToken) GetEnd() Position {
+	return Position{Line: t.endLine, Column: t.endColumn}
+}
 func (t IdentifierToken) GetValue() string {
 	return t.value
 }
@@ -15,42 +15,70 @@ var singleRuneTokenType = map[rune]TokenID{
 	')': TokenRightParen,
 	'{': TokenLeftCurly,
 	'}': TokenRightCurly,
+	'[': TokenLeftBracket,
+	']': TokenRightBracket,
 	',': TokenComma,
-	'-': TokenMinus,
-	'+': TokenPlus,
-	'*': TokenStar,
+	':': TokenColon,
 	';': TokenSemicolon,
 }
 
 var keywordTokenTypes = map[string]TokenID{
-	"true":   TokenTrue,
-	"false":  TokenFalse,
-	"nil":    TokenNil,
-	"and":    TokenAnd,
-	"or":     TokenOr,
-	"if":     TokenIf,
-	"else":   TokenElse,
-	"for":    TokenFor,
-	"while":  TokenWhile,
-	"func":   TokenFunc,
-	"return": TokenReturn,
-	"class":  TokenClass,
-	"super":  TokenSuper,
-	"this":   TokenThis,
+	"true":     TokenTrue,
+	"false":    TokenFalse,
+	"nil":      TokenNil,
+	"and":      TokenAnd,
+	"or":       TokenOr,
+	"if":       TokenIf,
+	"else":     TokenElse,
+	"match":    TokenMatch,
+	"for":      TokenFor,
+	"in":       TokenIn,
+	"while":    TokenWhile,
+	"do":       TokenDo,
+	"break":    TokenBreak,
+	"continue": TokenContinue,
+	"func":     TokenFunc,
+	"return":   TokenReturn,
+	"throw":    TokenThrow,
+	"try":      TokenTry,
+	"catch":    TokenCatch,
+	"finally":  TokenFinally,
+	"let":      TokenLet,
+	"const":    TokenConst,
+	"class":    TokenClass,
+	"super":    TokenSuper,
+	"this":     TokenThis,
+}
+
+// Limits bound the input that a tokenizer accepts, for callers tokenizing
+// untrusted input. A limit of zero means there is no limit.
+type Limits struct {
+	MaxInputSize int
+	MaxTokens    int
 }
 
 type Tokenizer struct {
-	input  *bufio.Reader
-	line   int
-	column int
+	input    *bufio.Reader
+	limited  *limitedReader
+	line     int
+	column   int
+	comments []CommentToken
+	limits   Limits
 }
 
 func NewTokenizer(input io.Reader) *Tokenizer {
-	t := &Tokenizer{input: bufio.NewReader(input)}
+	limited := &limitedReader{input: input}
+	t := &Tokenizer{input: bufio.NewReader(limited), limited: limited}
 	t.line = 1
 	return t
 }
 
+// SetLimits sets the limits for the input. It must be called before Tokenize.
+func (t *Tokenizer) SetLimits(limits Limits) {
+	t.limits = limits
+	t.limited.limit = limits.MaxInputSize
+}
+
 func (t *Tokenizer) Tokenize() ([]TokenHolder, error) {
 	tokens := make([]TokenHolder, 0)
 	for {
@@ -65,7 +93,9 @@ func (t *Tokenizer) Tokenize() ([]TokenHolder, error) {
 		t.column++
 
 		if tokenID, ok := singleRuneTokenType[r]; ok {
-			tokens = append(tokens, t.token(tokenID))
+			if tokens, err = t.appendToken(tokens, t.token(tokenID)); err != nil {
+				return tokens, err
+			}
 			continue
 		}
 		if unicode.IsSpace(r) {
@@ -82,45 +112,53 @@ func (t *Tokenizer) Tokenize() ([]TokenHolder, error) {
 		case '.':
 			if numberToken, err := t.number(); err == nil {
 				token = numberToken
+			} else if t.consumeIfNext('.') {
+				if !t.consumeIfNext('.') {
+					return tokens, &UnexpectedCharacterError{
+						character: '.',
+						line:      t.line,
+						column:    t.column,
+					}
+				}
+				ellipsis := t.token(TokenEllipsis)
+				ellipsis.column -= 2
+				token = ellipsis
 			} else {
 				token = t.token(TokenDot)
 			}
 		case '-':
-			token = t.token(TokenMinus)
+			token = t.tokenIfNext('=', TokenMinusEqual, TokenMinus)
 		case '+':
-			token = t.token(TokenPlus)
+			token = t.tokenIfNext('=', TokenPlusEqual, TokenPlus)
 		case '*':
-			token = t.token(TokenStar)
+			token = t.tokenIfNext('=', TokenStarEqual, TokenStar)
 		case '/':
 			if t.consumeIfNext('/') {
-				t.consumeUntilEOL()
+				if err := t.comment(); err != nil && err != io.EOF {
+					return tokens, err
+				}
 				continue
 			}
-			token = t.token(TokenSlash)
-		case '!':
-			if t.consumeIfNext('=') {
-				token = t.token(TokenBangEqual)
-			} else {
-				token = t.token(TokenBang)
+			if t.consumeIfNext('*') {
+				if err := t.blockComment(); err != nil {
+					return tokens, err
+				}
+				continue
 			}
+			token = t.tokenIfNext('=', TokenSlashEqual, TokenSlash)
+		case '!':
+			token = t.tokenIfNext('=', TokenBangEqual, TokenBang)
 		case '=':
-			if t.consumeIfNext('=') {
-				token = t.token(TokenEqualEqual)
-			} else {
-				token = t.token(TokenEqual)
+			equal := t.tokenIfNext('=', TokenEqualEqual, TokenEqual)
+			if equal.id == TokenEqual && t.consumeIfNext('>') {
+				equal.id = TokenArrow
+				equal.endColumn = t.column + 1
 			}
+			token = equal
 		case '>':
-			if t.consumeIfNext('=') {
-				token = t.token(TokenGreaterEqual)
-			} else {
-				token = t.token(TokenGreater)
-			}
+			token = t.tokenIfNext('=', TokenGreaterEqual, TokenGreater)
 		case '<':
-			if t.consumeIfNext('=') {
-				token = t.token(TokenLessEqual)
-			} else {
-				token = t.token(TokenLess)
-			}
+			token = t.tokenIfNext('=', TokenLessEqual, TokenLess)
 		case '"', '\'':
 			token, err = t.string(r)
 			if err != nil {
@@ -147,17 +185,44 @@ func (t *Tokenizer) Tokenize() ([]TokenHolder, error) {
 				}
 			}
 		}
-		tokens = append(tokens, token)
+		if tokens, err = t.appendToken(tokens, token); err != nil {
+			return tokens, err
+		}
+	}
+	return tokens, nil
+}
+
+// appendToken appends token to tokens, failing once there are more tokens than
+// the limit allows.
+func (t *Tokenizer) appendToken(tokens []TokenHolder, token TokenHolder) ([]TokenHolder, error) {
+	tokens = append(tokens, token)
+	if t.limits.MaxTokens > 0 && len(tokens) > t.limits.MaxTokens {
+		return tokens, &TooManyTokensError{
+			limit:  t.limits.MaxTokens,
+			line:   token.GetLine(),
+			column: token.GetColumn(),
+		}
 	}
 	return tokens, nil
 }
 
 func (t *Tokenizer) token(tokenID TokenID) Token {
 	return Token{
-		id:     tokenID,
-		line:   t.line,
-		column: t.column,
+		id:        tokenID,
+		line:      t.line,
+		column:    t.column,
+		endLine:   t.line,
+		endColumn: t.column + 1,
+	}
+}
+
+func (t *Tokenizer) tokenIfNext(expected rune, matched TokenID, unmatched TokenID) Token {
+	token := t.token(unmatched)
+	if t.consumeIfNext(expected) {
+		token.id = matched
+		token.endColumn = t.column + 1
 	}
+	return token
 }
 
 func (t *Tokenizer) string(delimiter rune) (StringToken, error) {
@@ -204,8 +269,14 @@ func (t *Tokenizer) string(delimiter rune) (StringToken, error) {
 		if r == delimiter {
 			break
 		}
+		if r == '\n' {
+			t.column = 0
+			t.line++
+		}
 		sb.WriteRune(r)
 	}
+	token.endLine = t.line
+	token.endColumn = t.column + 1
 	token.value = sb.String()
 	return token, nil
 }
@@ -215,6 +286,7 @@ func (t *Tokenizer) number() (NumberToken, error) {
 		Token: Token{id: TokenNumber, line: t.line, column: t.column},
 	}
 	err := t.input.UnreadRune()
+	t.column--
 	if err != nil {
 		return token, err
 	}
@@ -227,6 +299,7 @@ func (t *Tokenizer) number() (NumberToken, error) {
 				t.input.UnreadRune()
 				break
 			}
+			t.column++
 			sb.WriteRune(r)
 			isFractional = true
 			continue
@@ -238,6 +311,8 @@ func (t *Tokenizer) number() (NumberToken, error) {
 		t.column++
 		sb.WriteRune(r)
 	}
+	token.endLine = t.line
+	token.endColumn = t.column + 1
 	value, err := strconv.ParseFloat(sb.String(), 64)
 	if err != nil {
 		return token, err
@@ -275,6 +350,8 @@ func (t *Tokenizer) identifier() (IdentifierToken, error) {
 		t.column++
 		sb.WriteRune(r)
 	}
+	token.endLine = t.line
+	token.endColumn = t.column + 1
 	value := sb.String()
 	if keywordTokenType, ok := keywordTokenTypes[value]; ok {
 		token.id = keywordTokenType
@@ -298,15 +375,91 @@ func (t *Tokenizer) consumeIfNext(expected rune) bool {
 		t.input.UnreadRune()
 		return false
 	}
+	t.column++
 	return true
 }
 
-func (t *Tokenizer) consumeUntilEOL() error {
+// Comments returns the comments found by Tokenize in the order they appear.
+func (t *Tokenizer) Comments() []CommentToken {
+	return t.comments
+}
+
+func (t *Tokenizer) comment() error {
+	token := CommentToken{
+		Token: Token{id: TokenComment, line: t.line, column: t.column - 1},
+	}
+	var sb strings.Builder
+	sb.WriteString("//")
+	var err error
 	for {
-		r, _, err := t.input.ReadRune()
+		var r rune
+		r, _, err = t.input.ReadRune()
 		if err != nil || r == '\n' {
 			t.input.UnreadRune()
+			break
+		}
+		t.column++
+		sb.WriteRune(r)
+	}
+	token.endLine = t.line
+	token.endColumn = t.column + 1
+	token.value = strings.TrimRightFunc(sb.String(), unicode.IsSpace)
+	t.comments = append(t.comments, token)
+	return err
+}
+
+func (t *Tokenizer) blockComment() error {
+	token := CommentToken{
+		Token: Token{id: TokenComment, line: t.line, column: t.column - 1},
+	}
+	var sb strings.Builder
+	sb.WriteString("/*")
+	for {
+		r, _, err := t.input.ReadRune()
+		if err == io.EOF {
+			return &UnterminatedCommentError{line: token.line, column: token.column}
+		}
+		if err != nil {
 			return err
 		}
+		t.column++
+		sb.WriteRune(r)
+		if r == '\n' {
+			t.column = 0
+			t.line++
+		} else if r == '*' && t.consumeIfNext('/') {
+			sb.WriteRune('/')
+			break
+		}
+	}
+	token.endLine = t.line
+	token.endColumn = t.column + 1
+	token.value = sb.String()
+	t.comments = append(t.comments, token)
+	return nil
+}
+
+// limitedReader fails every read once more than limit bytes have been read,
+// so that the error can't be missed by the tokenizer's lookahead.
+type limitedReader struct {
+	input io.Reader
+	limit int
+	read  int
+	err   error
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.limit > 0 && len(p) > r.limit-r.read+1 {
+		p = p[:r.limit-r.read+1]
+	}
+	n, err := r.input.Read(p)
+	r.read += n
+	if r.limit > 0 && r.read > r.limit {
+		r.err = &InputTooLargeError{limit: r.limit}
+		return 0, r.err
 	}
+	return n, err
 }
@@ -1,9 +1,11 @@
 package tokenize
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
+	"brianhang.me/interpreter/diagnostic"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -24,6 +26,10 @@ func TestTokenizer(t *testing.T) {
 			"true == true and true or !false != false",
 			[]TokenID{TokenTrue, TokenEqualEqual, TokenTrue, TokenAnd, TokenTrue, TokenOr, TokenBang, TokenFalse, TokenBangEqual, TokenFalse},
 		},
+		{
+			"a += 1 b -= -2 c *= d /= e/f",
+			[]TokenID{TokenIdentifier, TokenPlusEqual, TokenNumber, TokenIdentifier, TokenMinusEqual, TokenMinus, TokenNumber, TokenIdentifier, TokenStarEqual, TokenIdentifier, TokenSlashEqual, TokenIdentifier, TokenSlash, TokenIdentifier},
+		},
 		{
 			"-3.14 // ratio",
 			[]TokenID{TokenMinus, TokenNumber},
@@ -32,6 +38,18 @@ func TestTokenizer(t *testing.T) {
 			"func foo() {while (true) { return }}",
 			[]TokenID{TokenFunc, TokenIdentifier, TokenLeftParen, TokenRightParen, TokenLeftCurly, TokenWhile, TokenLeftParen, TokenTrue, TokenRightParen, TokenLeftCurly, TokenReturn, TokenRightCurly, TokenRightCurly},
 		},
+		{
+			"try { throw e } catch (e: Err) { } finally { }",
+			[]TokenID{TokenTry, TokenLeftCurly, TokenThrow, TokenIdentifier, TokenRightCurly, TokenCatch, TokenLeftParen, TokenIdentifier, TokenColon, TokenIdentifier, TokenRightParen, TokenLeftCurly, TokenRightCurly, TokenFinally, TokenLeftCurly, TokenRightCurly},
+		},
+		{
+			"match (x) { 1 => y, _ => z == w }",
+			[]TokenID{TokenMatch, TokenLeftParen, TokenIdentifier, TokenRightParen, TokenLeftCurly, TokenNumber, TokenArrow, TokenIdentifier, TokenComma, TokenIdentifier, TokenArrow, TokenIdentifier, TokenEqualEqual, TokenIdentifier, TokenRightCurly},
+		},
+		{
+			"f(a, ...rest) .5",
+			[]TokenID{TokenIdentifier, TokenLeftParen, TokenIdentifier, TokenComma, TokenEllipsis, TokenIdentifier, TokenRightParen, TokenNumber},
+		},
 		{
 			"ε = .0000001",
 			[]TokenID{TokenIdentifier, TokenEqual, TokenNumber},
@@ -86,6 +104,11 @@ func TestTokenizeString(t *testing.T) {
 	tokenizer := NewTokenizer(strings.NewReader("x = 'unclosed string"))
 	_, err := tokenizer.Tokenize()
 	assert.Contains(t, err.Error(), "Expected a closing '")
+	var d *diagnostic.Diagnostic
+	if assert.True(t, errors.As(err, &d)) {
+		assert.Equal(t, CodeUnterminatedString, d.Code)
+		assert.Equal(t, diagnostic.Span{Start: Position{Line: 1, Column: 5}, End: Position{Line: 1, Column: 6}}, d.Span)
+	}
 }
 
 func TestTokenPosition(t *testing.T) {
@@ -130,6 +153,110 @@ func TestTokenPosition(t *testing.T) {
 	}
 }
 
+func TestTokenEnd(t *testing.T) {
+	cases := []struct {
+		source       string
+		expectedEnds []Position
+	}{
+		{
+			"a != b>=c",
+			[]Position{{Line: 1, Column: 2}, {Line: 1, Column: 5}, {Line: 1, Column: 7}, {Line: 1, Column: 9}, {Line: 1, Column: 10}},
+		},
+		{
+			"...x",
+			[]Position{{Line: 1, Column: 4}, {Line: 1, Column: 5}},
+		},
+		{
+			"1337 3.5 .25",
+			[]Position{{Line: 1, Column: 5}, {Line: 1, Column: 9}, {Line: 1, Column: 13}},
+		},
+		{
+			"'multi\nline' x",
+			[]Position{{Line: 2, Column: 6}, {Line: 2, Column: 8}},
+		},
+	}
+	for _, test := range cases {
+		source := test.source
+		tokens := tokenizeString(t, source)
+		ends := make([]Position, len(tokens))
+		for i, token := range tokens {
+			ends[i] = token.GetEnd()
+		}
+		assert.Equal(t, test.expectedEnds, ends, "Token ends are incorrect for \"%s\"", source)
+	}
+}
+
+func TestComments(t *testing.T) {
+	tokenizer := NewTokenizer(strings.NewReader("// first  \nx = 1 // second\n//"))
+	tokens, err := tokenizer.Tokenize()
+	assert.NoError(t, err)
+	assert.Len(t, tokens, 3)
+	comments := tokenizer.Comments()
+	if assert.Len(t, comments, 3) {
+		assert.Equal(t, "// first", comments[0].GetValue())
+		assert.Equal(t, Position{Line: 1, Column: 1}, comments[0].GetPos())
+		assert.Equal(t, "// second", comments[1].GetValue())
+		assert.Equal(t, Position{Line: 2, Column: 7}, comments[1].GetPos())
+		assert.Equal(t, Position{Line: 2, Column: 16}, comments[1].GetEnd())
+		assert.Equal(t, "//", comments[2].GetValue())
+		assert.Equal(t, Position{Line: 3, Column: 1}, comments[2].GetPos())
+	}
+
+	tokenizer = NewTokenizer(strings.NewReader("/** doc\n * more */ x /* a*b */ / y /// line\n//// not\n/**/"))
+	tokens, err = tokenizer.Tokenize()
+	assert.NoError(t, err)
+	if assert.Len(t, tokens, 3) {
+		assert.Equal(t, Position{Line: 2, Column: 12}, tokens[0].GetPos())
+		assert.Equal(t, TokenSlash, tokens[1].GetID())
+	}
+	comments = tokenizer.Comments()
+	if assert.Len(t, comments, 5) {
+		assert.Equal(t, "/** doc\n * more */", comments[0].GetValue())
+		assert.Equal(t, Position{Line: 1, Column: 1}, comments[0].GetPos())
+		assert.Equal(t, Position{Line: 2, Column: 11}, comments[0].GetEnd())
+		assert.True(t, comments[0].IsDoc())
+		assert.Equal(t, "/* a*b */", comments[1].GetValue())
+		assert.False(t, comments[1].IsDoc())
+		assert.Equal(t, "/// line", comments[2].GetValue())
+		assert.True(t, comments[2].IsDoc())
+		assert.False(t, comments[3].IsDoc())
+		assert.False(t, comments[4].IsDoc())
+	}
+
+	_, err = NewTokenizer(strings.NewReader("x\n  /* open")).Tokenize()
+	assert.EqualError(t, err, "Expected a closing */ for comment starting on line 2 at column 3")
+	var d *diagnostic.Diagnostic
+	if assert.True(t, errors.As(err, &d)) {
+		assert.Equal(t, CodeUnterminatedComment, d.Code)
+		assert.Equal(t, diagnostic.Span{Start: Position{Line: 2, Column: 3}, End: Position{Line: 2, Column: 5}}, d.Span)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	source := strings.Repeat("abc ", 5000)
+	tokenizer := NewTokenizer(strings.NewReader(source))
+	tokenizer.SetLimits(Limits{MaxInputSize: len(source)})
+	tokens, err := tokenizer.Tokenize()
+	assert.NoError(t, err)
+	assert.Len(t, tokens, 5000)
+
+	tokenizer = NewTokenizer(strings.NewReader(source + "x"))
+	tokenizer.SetLimits(Limits{MaxInputSize: len(source)})
+	_, err = tokenizer.Tokenize()
+	assert.EqualError(t, err, "Input is larger than the limit of 20000 bytes")
+
+	tokenizer = NewTokenizer(strings.NewReader(source))
+	tokenizer.SetLimits(Limits{MaxTokens: 4999})
+	_, err = tokenizer.Tokenize()
+	assert.EqualError(t, err, "Input has more than the limit of 4999 tokens, reached on line 1 at column 19997")
+
+	tokenizer = NewTokenizer(strings.NewReader(strings.Repeat("(", 50)))
+	tokenizer.SetLimits(Limits{MaxTokens: 10})
+	tokens, err = tokenizer.Tokenize()
+	assert.EqualError(t, err, "Input has more than the limit of 10 tokens, reached on line 1 at column 11")
+	assert.Len(t, tokens, 11)
+}
+
 func tokenizeString(t *testing.T, source string) []TokenHolder {
 	tokenizer := NewTokenizer(strings.NewReader(source))
 	tokens, err := tokenizer.Tokenize()